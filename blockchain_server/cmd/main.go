@@ -12,8 +12,12 @@ func init() {
 
 func main() {
 	port := flag.Uint("port", 5000, "TCP Port Number for Blockchain Server")
+	dataDir := flag.String("datadir", "blockchain_data", "Directory for the on-disk chain storage")
+	storeKind := flag.String("store", server.STORE_FILE, "Chain storage backend: file or memory")
+	minerAddress := flag.String("miner", "", "Blockchain address that receives mining rewards (random wallet if empty)")
+	genesisFile := flag.String("genesis", "", "JSON genesis spec shared by the network (built-in genesis if empty)")
 	flag.Parse()
 
-	app := server.NewBlockchainServer(uint16(*port))
+	app := server.NewBlockchainServer(uint16(*port), *dataDir, *storeKind, *minerAddress, *genesisFile)
 	app.Run()
 }
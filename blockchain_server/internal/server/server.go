@@ -2,28 +2,53 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	breq "goblockchain/blockchain_server/pkg/dto/blockchain_requests"
 	bres "goblockchain/blockchain_server/pkg/dto/blockchain_responses"
+	butils "goblockchain/blockchain_server/pkg/utils"
+	"goblockchain/domain/block"
 	"goblockchain/domain/blockchain"
+	"goblockchain/domain/store"
 	"goblockchain/domain/transaction"
 	"goblockchain/domain/wallet"
 	"goblockchain/wallet_server/utils"
 	"io"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 var cache map[string]*blockchain.Blockchain = make(map[string]*blockchain.Blockchain)
 
+const (
+	STORE_FILE   = "file"
+	STORE_MEMORY = "memory"
+)
+
 type BlockchainServer struct {
-	port uint16
+	port         uint16
+	dataDir      string
+	storeKind    string
+	minerAddress string
+	genesisFile  string
 }
 
-func NewBlockchainServer(port uint16) *BlockchainServer {
+func NewBlockchainServer(
+	port uint16,
+	dataDir string,
+	storeKind string,
+	minerAddress string,
+	genesisFile string,
+) *BlockchainServer {
 	return &BlockchainServer{
-		port: port,
+		port:         port,
+		dataDir:      dataDir,
+		storeKind:    storeKind,
+		minerAddress: minerAddress,
+		genesisFile:  genesisFile,
 	}
 }
 
@@ -31,21 +56,58 @@ func (bcs *BlockchainServer) Port() uint16 {
 	return bcs.port
 }
 
+func (bcs *BlockchainServer) DataDir() string {
+	return filepath.Join(bcs.dataDir, strconv.Itoa(int(bcs.Port())))
+}
+
 func (bcs *BlockchainServer) GetBlockchain() *blockchain.Blockchain {
 	bc, ok := cache["blockchain"]
 
 	if !ok {
-		minersWallet := wallet.NewWallet()
-		bc = blockchain.NewBlockchain(
-			minersWallet.BlockchainAddress(),
+		s, err := bcs.newStore()
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+
+		minerAddress := bcs.minerAddress
+		if minerAddress == "" {
+			minerAddress = wallet.NewWallet().BlockchainAddress()
+		}
+
+		genesis := blockchain.DefaultGenesisSpec()
+		if bcs.genesisFile != "" {
+			genesis, err = blockchain.LoadGenesisSpec(bcs.genesisFile)
+			if err != nil {
+				log.Fatalf("ERROR: %v", err)
+			}
+		}
+
+		bc, err = blockchain.NewBlockchain(
+			minerAddress,
 			bcs.Port(),
+			s,
+			genesis,
 		)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
 		cache["blockchain"] = bc
 	}
 
 	return bc
 }
 
+func (bcs *BlockchainServer) newStore() (store.Store, error) {
+	switch bcs.storeKind {
+	case STORE_FILE:
+		return store.NewFileStore(bcs.DataDir())
+	case STORE_MEMORY:
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", bcs.storeKind)
+	}
+}
+
 func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -95,27 +157,31 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 			return
 		}
 
-		publicKey := wallet.PublicKeyFromString(*t.SenderPublicKey)
-		signature := wallet.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockchain()
 
-		isCreated := bc.CreateTransaction(
+		transaction := transaction.NewTransaction(
 			*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress,
-			*t.Value,
-			publicKey,
-			signature,
+			*t.SenderPublicKey,
+			*t.Nonce,
+			t.FeeValue(),
+			*t.Inputs,
+			*t.Outputs,
+			*t.Signature,
 		)
+		err = bc.CreateTransaction(transaction)
 
 		w.Header().Add("Content-Type", "application/json")
 
 		var m []byte
-		if !isCreated {
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			m, _ = utils.JsonStatus("fail")
+			m, _ = json.Marshal(bres.NewErrorResponse(err))
 		} else {
 			w.WriteHeader(http.StatusCreated)
-			m, _ = utils.JsonStatus("success")
+			m, _ = json.Marshal(bres.TransactionCreatedResponse{
+				Message: "success",
+				ID:      transaction.ID(),
+			})
 		}
 
 		io.WriteString(w, string(m))
@@ -136,24 +202,25 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 			return
 		}
 
-		publicKey := wallet.PublicKeyFromString(*t.SenderPublicKey)
-		signature := wallet.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockchain()
 
-		isUpdated := bc.AddTransaction(
+		transaction := transaction.NewTransaction(
 			*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress,
-			*t.Value,
-			publicKey,
-			signature,
+			*t.SenderPublicKey,
+			*t.Nonce,
+			t.FeeValue(),
+			*t.Inputs,
+			*t.Outputs,
+			*t.Signature,
 		)
+		err = bc.AddTransaction(transaction)
 
 		w.Header().Add("Content-Type", "application/json")
 
 		var m []byte
-		if !isUpdated {
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			m, _ = utils.JsonStatus("fail")
+			m, _ = json.Marshal(bres.NewErrorResponse(err))
 		} else {
 			m, _ = utils.JsonStatus("success")
 		}
@@ -171,6 +238,197 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 	}
 }
 
+// Transaction serves GET /transactions/{id}.
+func (bcs *BlockchainServer) Transaction(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+
+		transactionHash, err := butils.HashFromString(strings.TrimPrefix(req.URL.Path, "/transactions/"))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		bc := bcs.GetBlockchain()
+		t, height, ok := bc.FindTransaction(transactionHash)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		res := bres.TransactionStatusResponse{
+			ID:          t.ID(),
+			Status:      bres.TRANSACTION_PENDING,
+			Transaction: t,
+		}
+		if height >= 0 {
+			res.Status = bres.TRANSACTION_CONFIRMED
+			res.BlockHeight = &height
+			res.Confirmations = bc.Confirmations(height)
+		}
+
+		m, _ := json.Marshal(res)
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Blocks serves GET /blocks?from=H&limit=N, a range of blocks, and POST
+// /blocks, through which neighbors push the blocks they mine or relay.
+func (bcs *BlockchainServer) Blocks(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bcs.blockRange(w, req, bres.NewBlockResponse)
+	case http.MethodPost:
+		w.Header().Add("Content-Type", "application/json")
+
+		var br breq.BlockRequest
+		if err := json.NewDecoder(req.Body).Decode(&br); err != nil || !br.Validate() {
+			log.Printf("ERROR: invalid block announcement: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		bc := bcs.GetBlockchain()
+		err := bc.ReceiveBlock(br.Block, *br.Origin)
+
+		var m []byte
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusCreated)
+			m, _ = utils.JsonStatus("success")
+		case errors.Is(err, blockchain.ErrKnownBlock), errors.Is(err, blockchain.ErrOrphanBlock):
+			w.WriteHeader(http.StatusAccepted)
+			m, _ = json.Marshal(bres.NewErrorResponse(err))
+		default:
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ = json.Marshal(bres.NewErrorResponse(err))
+		}
+
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Block serves GET /blocks/{height}, /blocks/hash/{hash} and /blocks/latest.
+func (bcs *BlockchainServer) Block(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+
+		bc := bcs.GetBlockchain()
+		path := strings.TrimPrefix(req.URL.Path, "/blocks/")
+
+		var b *block.Block
+		var err error
+
+		switch {
+		case path == "latest":
+			b = bc.LastBlock()
+		case strings.HasPrefix(path, "hash/"):
+			var hash [32]byte
+			hash, err = butils.HashFromString(strings.TrimPrefix(path, "hash/"))
+			if err == nil {
+				b, err = bc.BlockByHash(hash)
+			}
+		default:
+			var height int
+			height, err = strconv.Atoi(path)
+			if err == nil {
+				b, err = bc.BlockByHeight(height)
+			}
+		}
+
+		if errors.Is(err, store.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		m, _ := json.Marshal(bres.NewBlockResponse(b))
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Headers serves GET /headers?from=H&limit=N, a range of block headers.
+func (bcs *BlockchainServer) Headers(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bcs.blockRange(w, req, bres.NewHeaderResponse)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) blockRange(
+	w http.ResponseWriter,
+	req *http.Request,
+	newResponse func(b *block.Block) *bres.BlockResponse,
+) {
+	w.Header().Add("Content-Type", "application/json")
+
+	from, err := strconv.Atoi(req.URL.Query().Get("from"))
+	if err != nil || from < 0 {
+		log.Println("ERROR: invalid from")
+		w.WriteHeader(http.StatusBadRequest)
+		m, _ := utils.JsonStatus("fail")
+		io.WriteString(w, string(m))
+		return
+	}
+
+	limit := blockchain.MAX_BLOCKS_PER_REQUEST
+	if l := req.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			log.Println("ERROR: invalid limit")
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+	}
+
+	bc := bcs.GetBlockchain()
+	blocks := bc.BlockRange(from, limit)
+
+	res := bres.BlocksResponse{
+		Blocks: make([]*bres.BlockResponse, len(blocks)),
+		Length: len(blocks),
+	}
+	for i, b := range blocks {
+		res.Blocks[i] = newResponse(b)
+	}
+
+	m, _ := json.Marshal(res)
+	io.WriteString(w, string(m[:]))
+}
+
 func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
@@ -213,10 +471,53 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		amount := bcs.GetBlockchain().CalculateTotalAmount(blockchainAddress)
+		bc := bcs.GetBlockchain()
 
 		res := bres.AmountResponse{
-			Amount: amount,
+			Amount:        bc.CalculateTotalAmount(blockchainAddress),
+			PendingAmount: bc.CalculatePendingAmount(blockchainAddress),
+		}
+
+		m, _ := json.Marshal(res)
+
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Supply(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockchain()
+		height, supply := bc.Supply()
+
+		res := bres.SupplyResponse{
+			Height:            height,
+			CirculatingSupply: supply,
+			MaxSupply:         blockchain.MAX_SUPPLY,
+			BlockReward:       bc.BlockReward(height + 1),
+		}
+
+		m, _ := json.Marshal(res)
+
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Nonce(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+
+		res := bres.NonceResponse{
+			Nonce: bcs.GetBlockchain().NextNonce(blockchainAddress),
 		}
 
 		m, _ := json.Marshal(res)
@@ -229,6 +530,86 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (bcs *BlockchainServer) UnspentOutputs(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		outputs := bcs.GetBlockchain().UnspentOutputs(blockchainAddress)
+
+		res := bres.UnspentOutputsResponse{
+			Outputs: outputs,
+		}
+
+		m, _ := json.Marshal(res)
+
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) MerkleProof(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+
+		transactionHash, err := butils.HashFromString(req.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		bc := bcs.GetBlockchain()
+		b, branch, ok := bc.MerkleProof(transactionHash)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			m, _ := utils.JsonStatus("fail")
+			io.WriteString(w, string(m))
+			return
+		}
+
+		res := bres.MerkleProofResponse{
+			TransactionHash: fmt.Sprintf("%x", transactionHash),
+			BlockHash:       fmt.Sprintf("%x", b.Hash()),
+			BlockHeight:     b.Height,
+			MerkleRoot:      fmt.Sprintf("%x", b.MerkleRoot),
+			Branch:          branch,
+		}
+
+		m, _ := json.Marshal(res)
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Reorgs(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		bc := bcs.GetBlockchain()
+		reorgs := bc.Reorgs()
+
+		m, _ := json.Marshal(struct {
+			Reorgs []*blockchain.ReorgEvent `json:"reorgs"`
+			Length int                      `json:"length"`
+		}{
+			Reorgs: reorgs,
+			Length: len(reorgs),
+		})
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPut:
@@ -258,10 +639,19 @@ func (bcs *BlockchainServer) Run() {
 
 	http.HandleFunc("/", bcs.GetChain)
 	http.HandleFunc("/transactions", bcs.Transactions)
+	http.HandleFunc("/transactions/", bcs.Transaction)
+	http.HandleFunc("/transactions/proof", bcs.MerkleProof)
+	http.HandleFunc("/blocks", bcs.Blocks)
+	http.HandleFunc("/blocks/", bcs.Block)
+	http.HandleFunc("/headers", bcs.Headers)
 	http.HandleFunc("/mine", bcs.Mine)
 	http.HandleFunc("/mine/start", bcs.StartMining)
 	http.HandleFunc("/amount", bcs.Amount)
+	http.HandleFunc("/supply", bcs.Supply)
+	http.HandleFunc("/utxos", bcs.UnspentOutputs)
+	http.HandleFunc("/nonce", bcs.Nonce)
 	http.HandleFunc("/consensus", bcs.Consensus)
+	http.HandleFunc("/reorgs", bcs.Reorgs)
 
 	log.Fatal(http.ListenAndServe(host, nil))
 }
@@ -0,0 +1,18 @@
+package blockchainrequests
+
+import "goblockchain/domain/block"
+
+// BlockRequest announces a block. Origin is the host:port of the announcing
+// node, where missing ancestors of the block can be fetched.
+type BlockRequest struct {
+	Block  *block.Block `json:"block"`
+	Origin *string      `json:"origin"`
+}
+
+func (br *BlockRequest) Validate() bool {
+	if br.Block == nil || br.Origin == nil {
+		return false
+	}
+
+	return true
+}
@@ -1,21 +1,50 @@
 package blockchainrequests
 
+import (
+	"goblockchain/domain/amount"
+	"goblockchain/domain/transaction"
+)
+
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress *string                `json:"sender_blockchain_address"`
+	SenderPublicKey         *string                `json:"sender_public_key"`
+	Nonce                   *uint64                `json:"nonce"`
+	Fee                     *amount.Amount         `json:"fee"`
+	Inputs                  *[]*transaction.Input  `json:"inputs"`
+	Outputs                 *[]*transaction.Output `json:"outputs"`
+	Signature               *string                `json:"signature"`
 }
 
 func (tr *TransactionRequest) Validate() bool {
 	if tr.SenderBlockchainAddress == nil ||
-		tr.RecipientBlockchainAddress == nil ||
 		tr.SenderPublicKey == nil ||
-		tr.Value == nil ||
+		tr.Nonce == nil ||
+		tr.Inputs == nil ||
+		tr.Outputs == nil ||
 		tr.Signature == nil {
 		return false
 	}
 
+	for _, i := range *tr.Inputs {
+		if i == nil {
+			return false
+		}
+	}
+
+	for _, o := range *tr.Outputs {
+		if o == nil {
+			return false
+		}
+	}
+
 	return true
 }
+
+// FeeValue returns the optional fee, 0 if the request has none.
+func (tr *TransactionRequest) FeeValue() amount.Amount {
+	if tr.Fee == nil {
+		return 0
+	}
+
+	return *tr.Fee
+}
@@ -1,5 +1,9 @@
 package blockchainresponses
 
+import "goblockchain/domain/amount"
+
+// AmountResponse carries balances in base units.
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount        amount.Amount `json:"amount"`
+	PendingAmount amount.Amount `json:"pending_amount"`
 }
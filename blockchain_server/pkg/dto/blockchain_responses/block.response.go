@@ -0,0 +1,45 @@
+package blockchainresponses
+
+import (
+	"fmt"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+)
+
+type BlockResponse struct {
+	Hash         string                     `json:"hash"`
+	Height       int                        `json:"height"`
+	Timestamp    int64                      `json:"timestamp"`
+	Nonce        int                        `json:"nonce"`
+	PreviousHash string                     `json:"previous_hash"`
+	MerkleRoot   string                     `json:"merkle_root"`
+	Bits         uint32                     `json:"bits"`
+	Transactions []*transaction.Transaction `json:"transactions,omitempty"`
+}
+
+// BlocksResponse is a range of blocks, or of headers only.
+type BlocksResponse struct {
+	Blocks []*BlockResponse `json:"blocks"`
+	Length int              `json:"length"`
+}
+
+func NewBlockResponse(b *block.Block) *BlockResponse {
+	return &BlockResponse{
+		Hash:         fmt.Sprintf("%x", b.Hash()),
+		Height:       b.Height,
+		Timestamp:    b.Timestamp,
+		Nonce:        b.Nonce,
+		PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
+		MerkleRoot:   fmt.Sprintf("%x", b.MerkleRoot),
+		Bits:         b.Bits,
+		Transactions: b.Transactions,
+	}
+}
+
+// NewHeaderResponse is NewBlockResponse without the transactions.
+func NewHeaderResponse(b *block.Block) *BlockResponse {
+	res := NewBlockResponse(b)
+	res.Transactions = nil
+
+	return res
+}
@@ -0,0 +1,15 @@
+package blockchainresponses
+
+// ErrorResponse is a failure status with the reason the request was
+// rejected.
+type ErrorResponse struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+func NewErrorResponse(err error) *ErrorResponse {
+	return &ErrorResponse{
+		Message: "fail",
+		Reason:  err.Error(),
+	}
+}
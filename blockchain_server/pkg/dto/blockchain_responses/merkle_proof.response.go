@@ -0,0 +1,11 @@
+package blockchainresponses
+
+import "goblockchain/domain/block"
+
+type MerkleProofResponse struct {
+	TransactionHash string              `json:"transaction_hash"`
+	BlockHash       string              `json:"block_hash"`
+	BlockHeight     int                 `json:"block_height"`
+	MerkleRoot      string              `json:"merkle_root"`
+	Branch          []*block.MerkleStep `json:"branch"`
+}
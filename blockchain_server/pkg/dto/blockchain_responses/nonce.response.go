@@ -0,0 +1,5 @@
+package blockchainresponses
+
+type NonceResponse struct {
+	Nonce uint64 `json:"nonce"`
+}
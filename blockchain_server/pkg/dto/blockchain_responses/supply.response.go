@@ -0,0 +1,12 @@
+package blockchainresponses
+
+import "goblockchain/domain/amount"
+
+// SupplyResponse carries the supply in base units as of the block at Height.
+// BlockReward is the reward of the next block.
+type SupplyResponse struct {
+	Height            int           `json:"height"`
+	CirculatingSupply amount.Amount `json:"circulating_supply"`
+	MaxSupply         amount.Amount `json:"max_supply"`
+	BlockReward       amount.Amount `json:"block_reward"`
+}
@@ -0,0 +1,21 @@
+package blockchainresponses
+
+import "goblockchain/domain/transaction"
+
+const (
+	TRANSACTION_PENDING   = "pending"
+	TRANSACTION_CONFIRMED = "confirmed"
+)
+
+type TransactionCreatedResponse struct {
+	Message string `json:"message"`
+	ID      string `json:"id"`
+}
+
+type TransactionStatusResponse struct {
+	ID            string                   `json:"id"`
+	Status        string                   `json:"status"`
+	BlockHeight   *int                     `json:"block_height,omitempty"`
+	Confirmations int                      `json:"confirmations"`
+	Transaction   *transaction.Transaction `json:"transaction"`
+}
@@ -0,0 +1,7 @@
+package blockchainresponses
+
+import "goblockchain/domain/utxo"
+
+type UnspentOutputsResponse struct {
+	Outputs []*utxo.Entry `json:"outputs"`
+}
@@ -1,10 +1,12 @@
 package utils
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"os"
 	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -13,7 +15,7 @@ const LOCAL_HOST = "127.0.0.1"
 var IP_PATTERN = regexp.MustCompile(`\b(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\b`)
 
 func IsFoundHost(host string, port uint16) bool {
-	target := fmt.Sprintf("%s:%d", host, port)
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
 
 	_, err := net.DialTimeout("tcp", target, 1*time.Second)
 	if err != nil {
@@ -70,3 +72,20 @@ func GetHost() string {
 
 	return address[0]
 }
+
+func HashFromString(s string) ([32]byte, error) {
+	var hash [32]byte
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return hash, err
+	}
+
+	if len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid hash length %d", len(b))
+	}
+
+	copy(hash[:], b)
+
+	return hash, nil
+}
@@ -0,0 +1,115 @@
+package account
+
+import (
+	"fmt"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/utxo"
+)
+
+// Index keeps the confirmed balance and the next transaction nonce of every
+// address so that lookups do not have to scan the chain.
+type Index struct {
+	balances map[string]amount.Amount
+	nonces   map[string]uint64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		balances: make(map[string]amount.Amount),
+		nonces:   make(map[string]uint64),
+	}
+}
+
+// CheckBlock reports whether the transactions of every sender in the block
+// continue the sender's nonce sequence without reuse or gaps.
+func (idx *Index) CheckBlock(b *block.Block) error {
+	next := make(map[string]uint64)
+
+	for _, t := range b.Transactions {
+		if t.IsCoinbase() {
+			continue
+		}
+
+		expected, ok := next[t.SenderBlockchainAddress]
+		if !ok {
+			expected = idx.Nonce(t.SenderBlockchainAddress)
+		}
+
+		if t.Nonce != expected {
+			return fmt.Errorf(
+				"account: transaction of %s has nonce %d, expected %d",
+				t.SenderBlockchainAddress,
+				t.Nonce,
+				expected,
+			)
+		}
+
+		next[t.SenderBlockchainAddress] = expected + 1
+	}
+
+	return nil
+}
+
+// ApplyBlock credits the outputs of the block and debits the owners of the
+// entries it spent, as returned by utxo.Set.ApplyBlock.
+func (idx *Index) ApplyBlock(b *block.Block, spent []*utxo.Entry) {
+	for _, e := range spent {
+		idx.add(e.Output.BlockchainAddress, -e.Output.Value)
+	}
+
+	for _, t := range b.Transactions {
+		if !t.IsCoinbase() {
+			idx.nonces[t.SenderBlockchainAddress] = t.Nonce + 1
+		}
+
+		for _, o := range t.Outputs {
+			idx.add(o.BlockchainAddress, o.Value)
+		}
+	}
+}
+
+// UndoBlock reverts ApplyBlock for the same block and spent entries.
+func (idx *Index) UndoBlock(b *block.Block, spent []*utxo.Entry) {
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		t := b.Transactions[i]
+
+		for _, o := range t.Outputs {
+			idx.add(o.BlockchainAddress, -o.Value)
+		}
+
+		if t.IsCoinbase() {
+			continue
+		}
+
+		if t.Nonce == 0 {
+			delete(idx.nonces, t.SenderBlockchainAddress)
+		} else {
+			idx.nonces[t.SenderBlockchainAddress] = t.Nonce
+		}
+	}
+
+	for _, e := range spent {
+		idx.add(e.Output.BlockchainAddress, e.Output.Value)
+	}
+}
+
+func (idx *Index) add(blockchainAddress string, value amount.Amount) {
+	balance := idx.balances[blockchainAddress] + value
+
+	if balance == 0 {
+		delete(idx.balances, blockchainAddress)
+		return
+	}
+
+	idx.balances[blockchainAddress] = balance
+}
+
+func (idx *Index) Balance(blockchainAddress string) amount.Amount {
+	return idx.balances[blockchainAddress]
+}
+
+// Nonce returns the nonce the next transaction of the address must carry.
+func (idx *Index) Nonce(blockchainAddress string) uint64 {
+	return idx.nonces[blockchainAddress]
+}
@@ -0,0 +1,94 @@
+package amount
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coins in base units. All values on the chain are
+// integers so that balances never pick up rounding errors; decimal strings
+// are only used at the API edges.
+type Amount int64
+
+const (
+	DECIMALS = 8
+	COIN     = Amount(100000000)
+
+	// MAX_AMOUNT bounds every single value and every sum of values, so that
+	// adding amounts up can never overflow.
+	MAX_AMOUNT = 21000000 * COIN
+)
+
+var ErrInvalidAmount = errors.New("amount: invalid decimal amount")
+
+// Valid reports whether the amount is within [0, MAX_AMOUNT].
+func (a Amount) Valid() bool {
+	return a >= 0 && a <= MAX_AMOUNT
+}
+
+// String formats the amount as a decimal number of coins without trailing
+// zeros, e.g. 150000000 as "1.5".
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+
+	whole := strconv.FormatInt(int64(a/COIN), 10)
+	frac := strconv.FormatInt(int64(a%COIN), 10)
+	frac = strings.Repeat("0", DECIMALS-len(frac)) + frac
+	frac = strings.TrimRight(frac, "0")
+
+	if frac == "" {
+		return sign + whole
+	}
+
+	return sign + whole + "." + frac
+}
+
+// Parse reads a non-negative decimal number of coins with at most DECIMALS
+// fractional digits, e.g. "1.5" as 150000000.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	if len(frac) > DECIMALS || !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalidAmount
+	}
+
+	var a Amount
+	if whole != "" {
+		w, err := strconv.ParseInt(whole, 10, 64)
+		if err != nil || w > int64(MAX_AMOUNT/COIN) {
+			return 0, ErrInvalidAmount
+		}
+		a = Amount(w) * COIN
+	}
+
+	if frac != "" {
+		f, _ := strconv.ParseInt(frac+strings.Repeat("0", DECIMALS-len(frac)), 10, 64)
+		a += Amount(f)
+	}
+
+	if !a.Valid() {
+		return 0, ErrInvalidAmount
+	}
+
+	return a, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
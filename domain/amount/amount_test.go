@@ -0,0 +1,82 @@
+package amount
+
+import "testing"
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{COIN, "1"},
+		{150000000, "1.5"},
+		{123456789, "1.23456789"},
+		{10 * COIN, "10"},
+		{-150000000, "-1.5"},
+		{MAX_AMOUNT, "21000000"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.a), got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+	}{
+		{"0", 0},
+		{"1", COIN},
+		{"1.5", 150000000},
+		{" 1.5 ", 150000000},
+		{".5", 50000000},
+		{"5.", 5 * COIN},
+		{"0.00000001", 1},
+		{"1.23456789", 123456789},
+		{"21000000", MAX_AMOUNT},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.s, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.s, int64(got), int64(tt.want))
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		".",
+		"-1",
+		"+1",
+		"1e8",
+		"1.2.3",
+		"abc",
+		"0.000000001",
+		"21000000.00000001",
+		"99999999999999999999",
+	} {
+		if a, err := Parse(s); err != ErrInvalidAmount {
+			t.Errorf("Parse(%q) = %d, %v, want ErrInvalidAmount", s, int64(a), err)
+		}
+	}
+}
+
+func TestParseStringRoundTrip(t *testing.T) {
+	for _, a := range []Amount{0, 1, 99999999, COIN, 150000000, 123456789, MAX_AMOUNT} {
+		got, err := Parse(a.String())
+		if err != nil || got != a {
+			t.Errorf("Parse(%q) = %d, %v, want %d", a.String(), int64(got), err, int64(a))
+		}
+	}
+}
@@ -2,6 +2,7 @@ package block
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -12,28 +13,83 @@ import (
 type Block struct {
 	Timestamp    int64
 	Nonce        int
+	Height       int
 	PreviousHash [32]byte
+	MerkleRoot   [32]byte
+	Bits         uint32
 	Transactions []*t.Transaction
 }
 
-func NewBlock(none int, previousHash [32]byte, transactions []*t.Transaction) *Block {
+const (
+	HEADER_SIZE  = 8 + 8 + 32 + 32 + 4 + 8
+	NONCE_OFFSET = 8
+)
+
+func NewBlock(none int, height int, previousHash [32]byte, bits uint32, transactions []*t.Transaction) *Block {
 	return &Block{
 		Timestamp:    time.Now().UnixNano(),
 		Nonce:        none,
+		Height:       height,
 		PreviousHash: previousHash,
+		MerkleRoot:   MerkleRoot(transactions),
+		Bits:         bits,
 		Transactions: transactions,
 	}
 }
 
+// Hash covers the block header only. The transactions are committed to
+// through the Merkle root.
 func (b *Block) Hash() [32]byte {
+	return sha256.Sum256(b.HeaderBytes())
+}
+
+// Size is the length of the serialized block, which is what peers download.
+func (b *Block) Size() int {
 	m, _ := json.Marshal(b)
-	return sha256.Sum256(m)
+	return len(m)
+}
+
+// HeaderBytes is the fixed size big-endian encoding of the header that the
+// block hash is taken over.
+func (b *Block) HeaderBytes() []byte {
+	h := make([]byte, HEADER_SIZE)
+
+	binary.BigEndian.PutUint64(h[0:8], uint64(b.Timestamp))
+	PutHeaderNonce(h, b.Nonce)
+	copy(h[16:48], b.PreviousHash[:])
+	copy(h[48:80], b.MerkleRoot[:])
+	binary.BigEndian.PutUint32(h[80:84], b.Bits)
+	binary.BigEndian.PutUint64(h[84:92], uint64(b.Height))
+
+	return h
+}
+
+// PutHeaderNonce overwrites the nonce in an encoded header, so a miner can
+// try nonces without encoding the whole header again.
+func PutHeaderNonce(header []byte, nonce int) {
+	binary.BigEndian.PutUint64(header[NONCE_OFFSET:NONCE_OFFSET+8], uint64(nonce))
+}
+
+// MerkleProof returns the Merkle branch of the transaction with the given
+// hash, or false if the block does not contain it.
+func (b *Block) MerkleProof(transactionHash [32]byte) ([]*MerkleStep, bool) {
+	for i, tx := range b.Transactions {
+		if tx.Hash() == transactionHash {
+			branch, _ := MerkleBranch(b.Transactions, i)
+			return branch, true
+		}
+	}
+
+	return nil, false
 }
 
 func (b *Block) Print() {
 	fmt.Printf("timestamp %d\n", b.Timestamp)
 	fmt.Printf("nonce %d\n", b.Nonce)
+	fmt.Printf("height %d\n", b.Height)
 	fmt.Printf("previous_hash %x\n", b.PreviousHash)
+	fmt.Printf("merkle_root %x\n", b.MerkleRoot)
+	fmt.Printf("bits %08x\n", b.Bits)
 	for _, t := range b.Transactions {
 		t.Print()
 	}
@@ -43,27 +99,39 @@ func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Timestamp    int64            `json:"timestamp"`
 		Nonce        int              `json:"nonce"`
+		Height       int              `json:"height"`
 		PreviousHash string           `json:"previous_hash"`
+		MerkleRoot   string           `json:"merkle_root"`
+		Bits         uint32           `json:"bits"`
 		Transactions []*t.Transaction `json:"transactions"`
 	}{
 		Timestamp:    b.Timestamp,
 		Nonce:        b.Nonce,
+		Height:       b.Height,
 		PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
+		MerkleRoot:   fmt.Sprintf("%x", b.MerkleRoot),
+		Bits:         b.Bits,
 		Transactions: b.Transactions,
 	})
 }
 
 func (b *Block) UnmarshalJSON(data []byte) error {
-	var previousHash string
+	var previousHash, merkleRoot string
 	v := &struct {
 		Timestamp    *int64            `json:"timestamp"`
 		Nonce        *int              `json:"nonce"`
+		Height       *int              `json:"height"`
 		PreviousHash *string           `json:"previous_hash"`
+		MerkleRoot   *string           `json:"merkle_root"`
+		Bits         *uint32           `json:"bits"`
 		Transactions *[]*t.Transaction `json:"transactions"`
 	}{
 		Timestamp:    &b.Timestamp,
 		Nonce:        &b.Nonce,
+		Height:       &b.Height,
 		PreviousHash: &previousHash,
+		MerkleRoot:   &merkleRoot,
+		Bits:         &b.Bits,
 		Transactions: &b.Transactions,
 	}
 
@@ -71,8 +139,17 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	ph, _ := hex.DecodeString(*v.PreviousHash)
-	copy(b.PreviousHash[:], ph[:32])
+	ph, err := hex.DecodeString(previousHash)
+	if err != nil || len(ph) != 32 {
+		return fmt.Errorf("invalid previous_hash %q", previousHash)
+	}
+	copy(b.PreviousHash[:], ph)
+
+	mr, err := hex.DecodeString(merkleRoot)
+	if err != nil || len(mr) != 32 {
+		return fmt.Errorf("invalid merkle_root %q", merkleRoot)
+	}
+	copy(b.MerkleRoot[:], mr)
 
 	return nil
 }
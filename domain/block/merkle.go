@@ -0,0 +1,148 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	t "goblockchain/domain/transaction"
+)
+
+// MerkleStep is one level of a Merkle branch: the sibling hash and whether
+// it sits to the left of the running hash.
+type MerkleStep struct {
+	Hash [32]byte
+	Left bool
+}
+
+// MerkleRoot hashes the transactions pairwise up to a single root. A level
+// with an odd number of nodes pairs its last node with itself. The root of a
+// block without transactions is the zero hash.
+func MerkleRoot(transactions []*t.Transaction) [32]byte {
+	level := merkleLeaves(transactions)
+	if len(level) == 0 {
+		return [32]byte{}
+	}
+
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+
+	return level[0]
+}
+
+// MerkleBranch returns the sibling hashes that lead from the transaction at
+// index up to the Merkle root.
+func MerkleBranch(transactions []*t.Transaction, index int) ([]*MerkleStep, error) {
+	level := merkleLeaves(transactions)
+	if index < 0 || index >= len(level) {
+		return nil, fmt.Errorf("transaction index %d out of range", index)
+	}
+
+	branch := make([]*MerkleStep, 0)
+
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling >= len(level) {
+			sibling = index
+		}
+
+		branch = append(branch, &MerkleStep{
+			Hash: level[sibling],
+			Left: sibling < index,
+		})
+
+		level = merkleParents(level)
+		index /= 2
+	}
+
+	return branch, nil
+}
+
+// VerifyMerkleBranch reports whether the branch leads from the transaction
+// hash to the Merkle root.
+func VerifyMerkleBranch(transactionHash [32]byte, branch []*MerkleStep, root [32]byte) bool {
+	h := transactionHash
+
+	for _, s := range branch {
+		if s.Left {
+			h = merkleHashPair(s.Hash, h)
+		} else {
+			h = merkleHashPair(h, s.Hash)
+		}
+	}
+
+	return h == root
+}
+
+func merkleLeaves(transactions []*t.Transaction) [][32]byte {
+	leaves := make([][32]byte, len(transactions))
+
+	for i, tx := range transactions {
+		leaves[i] = tx.Hash()
+	}
+
+	return leaves
+}
+
+func merkleParents(level [][32]byte) [][32]byte {
+	parents := make([][32]byte, 0, (len(level)+1)/2)
+
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+
+		parents = append(parents, merkleHashPair(level[i], right))
+	}
+
+	return parents
+}
+
+func merkleHashPair(left, right [32]byte) [32]byte {
+	var m [64]byte
+	copy(m[:32], left[:])
+	copy(m[32:], right[:])
+
+	return sha256.Sum256(m[:])
+}
+
+func (s *MerkleStep) MarshalJSON() ([]byte, error) {
+	position := "right"
+	if s.Left {
+		position = "left"
+	}
+
+	return json.Marshal(struct {
+		Hash     string `json:"hash"`
+		Position string `json:"position"`
+	}{
+		Hash:     fmt.Sprintf("%x", s.Hash),
+		Position: position,
+	})
+}
+
+func (s *MerkleStep) UnmarshalJSON(data []byte) error {
+	var hash, position string
+	v := &struct {
+		Hash     *string `json:"hash"`
+		Position *string `json:"position"`
+	}{
+		Hash:     &hash,
+		Position: &position,
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	h, err := hex.DecodeString(hash)
+	if err != nil || len(h) != 32 {
+		return fmt.Errorf("invalid merkle step hash %q", hash)
+	}
+	copy(s.Hash[:], h)
+	s.Left = position == "left"
+
+	return nil
+}
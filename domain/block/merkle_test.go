@@ -0,0 +1,89 @@
+package block
+
+import (
+	"testing"
+
+	t "goblockchain/domain/transaction"
+)
+
+func testTransactions(n int) []*t.Transaction {
+	transactions := make([]*t.Transaction, n)
+	for i := range transactions {
+		transactions[i] = t.NewTransaction("sender", "", uint64(i), 0, nil, nil, "")
+	}
+
+	return transactions
+}
+
+func TestMerkleRoot(test *testing.T) {
+	txs := testTransactions(3)
+	a, b, c := txs[0].Hash(), txs[1].Hash(), txs[2].Hash()
+
+	tests := []struct {
+		name         string
+		transactions []*t.Transaction
+		want         [32]byte
+	}{
+		{"empty", nil, [32]byte{}},
+		{"single", txs[:1], a},
+		{"pair", txs[:2], merkleHashPair(a, b)},
+		{"odd leaf is paired with itself", txs, merkleHashPair(merkleHashPair(a, b), merkleHashPair(c, c))},
+	}
+
+	for _, tt := range tests {
+		if got := MerkleRoot(tt.transactions); got != tt.want {
+			test.Errorf("%s: MerkleRoot = %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerkleBranch(test *testing.T) {
+	for n := 1; n <= 9; n++ {
+		txs := testTransactions(n)
+		root := MerkleRoot(txs)
+
+		for i, tx := range txs {
+			branch, err := MerkleBranch(txs, i)
+			if err != nil {
+				test.Fatalf("%d transactions, index %d: %v", n, i, err)
+			}
+
+			if !VerifyMerkleBranch(tx.Hash(), branch, root) {
+				test.Errorf("%d transactions, index %d: branch does not verify", n, i)
+			}
+
+			other := txs[(i+1)%n].Hash()
+			if n > 1 && VerifyMerkleBranch(other, branch, root) {
+				test.Errorf("%d transactions, index %d: branch verifies another transaction", n, i)
+			}
+		}
+	}
+}
+
+func TestMerkleBranchLastOddLeaf(test *testing.T) {
+	txs := testTransactions(5)
+
+	branch, err := MerkleBranch(txs, 4)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The last leaf of an odd level is its own sibling.
+	if branch[0].Hash != txs[4].Hash() || branch[0].Left {
+		test.Errorf("first step = %x left=%v, want the leaf itself on the right", branch[0].Hash, branch[0].Left)
+	}
+
+	if len(branch) != 3 {
+		test.Errorf("branch has %d steps, want 3", len(branch))
+	}
+}
+
+func TestMerkleBranchOutOfRange(test *testing.T) {
+	txs := testTransactions(3)
+
+	for _, i := range []int{-1, 3} {
+		if _, err := MerkleBranch(txs, i); err == nil {
+			test.Errorf("MerkleBranch(%d) succeeded", i)
+		}
+	}
+}
@@ -5,50 +5,128 @@ import (
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	breq "goblockchain/blockchain_server/pkg/dto/blockchain_requests"
 	"goblockchain/blockchain_server/pkg/utils"
+	"goblockchain/domain/amount"
 	"goblockchain/domain/block"
+	"goblockchain/domain/mempool"
+	"goblockchain/domain/pow"
+	"goblockchain/domain/store"
 	"goblockchain/domain/transaction"
+	"goblockchain/domain/utxo"
 	"goblockchain/domain/wallet"
 	"log"
+	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	MINING_DIFFICULTY                 = 3
+	MINING_BITS                       = 0x1f0fffff // default initial target, see DefaultGenesisSpec
 	MINING_SENDER                     = "THE BLOCKCHAIN"
-	MINING_REWARD                     = 1.0
+	MINING_REWARD                     = 1 * amount.COIN // before the first halving, see BlockReward
 	MINING_TIMER_SEC                  = 20
 	BLOCKCHAIN_PORT_RANGE_START       = 5000
 	BLOCKCHAIN_PORT_RANGE_END         = 5003
 	NEIGHBOR_IP_RANGE_START           = 0
 	NEIGHBOR_IP_RANGE_END             = 1
 	BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC = 20
+	TRANSACTION_POOL_MAX_SIZE         = 5000
+	TRANSACTION_POOL_EXPIRY_SEC       = 60 * 60
+	COINBASE_MATURITY                 = 10
+)
+
+var (
+	ErrMalformedTransaction = errors.New("transaction has a missing input or output")
+	ErrCoinbaseTransaction  = errors.New("coinbase transactions are created by mining only")
+	ErrPublicKeyMismatch    = errors.New("public key does not match the sender")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrInvalidNonce         = errors.New("reused or out-of-order nonce")
+	ErrEmptyTransaction     = errors.New("transaction needs inputs and outputs")
+	ErrInvalidValue         = errors.New("output values must be positive and within the maximum amount")
+	ErrInvalidFee           = errors.New("fee must not be negative or above the maximum amount")
+	ErrUnknownInput         = errors.New("input is not an unspent output")
+	ErrInputNotOwned        = errors.New("input is not owned by the sender")
+	ErrDoubleSpend          = errors.New("input is already spent")
+	ErrImmatureCoinbase     = errors.New("input spends a coinbase output that is not mature yet")
+	ErrInputsTooLow         = errors.New("outputs plus fee exceed the inputs")
 )
 
 type Blockchain struct {
 	sync.Mutex
-	transactionPool   []*transaction.Transaction
+	transactionPool   *mempool.Pool
 	chain             []*block.Block
 	blockchainAddress string
 	port              uint16
+	store             store.Store
+	state             *chainState
+	reorgs            []*ReorgEvent
+	orphans           *orphanPool
+	genesis           *block.Block
 
 	neighbors    []string
 	muxNeighbors sync.Mutex
 }
 
-func NewBlockchain(blockchainAddress string, port uint16) *Blockchain {
-	b := &block.Block{}
+func NewBlockchain(
+	blockchainAddress string,
+	port uint16,
+	s store.Store,
+	genesis *GenesisSpec,
+) (*Blockchain, error) {
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
 	bc.port = port
-	bc.CreateBlock(0, b.Hash())
+	bc.store = s
+	bc.orphans = newOrphanPool()
+	bc.genesis = genesis.Block()
+
+	chain, err := s.LoadChain()
+	if err != nil {
+		return nil, err
+	}
+
+	bc.transactionPool = mempool.NewPool(
+		TRANSACTION_POOL_MAX_SIZE,
+		time.Second*TRANSACTION_POOL_EXPIRY_SEC,
+	)
+
+	transactions, err := s.LoadTransactionPool()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range transactions {
+		bc.transactionPool.Add(t)
+	}
+
+	if len(chain) > 0 {
+		if err := bc.checkGenesis(chain[0]); err != nil {
+			return nil, fmt.Errorf("stored chain: %w", err)
+		}
+
+		bc.state, err = rebuildState(chain)
+		if err != nil {
+			return nil, err
+		}
+
+		bc.chain = chain
+		log.Printf("action=load_chain, blocks=%d", len(chain))
+		return bc, nil
+	}
+
+	bc.state = newChainState()
 
-	return bc
+	if bc.CreateBlock(bc.genesis) == nil {
+		return nil, fmt.Errorf("failed to store genesis block")
+	}
+
+	return bc, nil
 }
 
 func (bc *Blockchain) SetNeighbors() {
@@ -67,6 +145,14 @@ func (bc *Blockchain) Run() {
 	bc.ResolveConflicts()
 }
 
+// Neighbors returns a copy of the current neighbor list.
+func (bc *Blockchain) Neighbors() []string {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+
+	return append([]string{}, bc.neighbors...)
+}
+
 func (bc *Blockchain) SyncNeighbors() {
 	bc.muxNeighbors.Lock()
 	defer bc.muxNeighbors.Unlock()
@@ -80,210 +166,500 @@ func (bc *Blockchain) StartSyncNeighbors() {
 }
 
 func (bc *Blockchain) Chain() []*block.Block {
+	bc.Lock()
+	defer bc.Unlock()
+
 	return bc.chain
 }
 
 func (bc *Blockchain) TransactionPool() []*transaction.Transaction {
-	return bc.transactionPool
+	return bc.transactionPool.Transactions()
 }
 
 func (bc *Blockchain) ClearTransactionPool() {
-	bc.transactionPool = bc.transactionPool[:0]
+	bc.transactionPool.Clear()
+	bc.saveTransactionPool()
+}
+
+func (bc *Blockchain) saveTransactionPool() {
+	if err := bc.store.SaveTransactionPool(bc.TransactionPool()); err != nil {
+		log.Printf("ERROR: %v", err)
+	}
+}
+
+func (bc *Blockchain) BlockByHeight(height int) (*block.Block, error) {
+	return bc.store.BlockByHeight(height)
+}
+
+func (bc *Blockchain) BlockByHash(hash [32]byte) (*block.Block, error) {
+	return bc.store.BlockByHash(hash)
 }
 
-func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *block.Block {
-	b := block.NewBlock(nonce, previousHash, bc.transactionPool)
+// CreateBlock appends a mined block to the chain and removes the
+// transactions it includes from the pool.
+func (bc *Blockchain) CreateBlock(b *block.Block) *block.Block {
+	if err := bc.connectBlock(b); err != nil {
+		log.Printf("ERROR: %v", err)
+		return nil
+	}
+
+	return b
+}
+
+// connectBlock validates the block against the tip of the chain, applies it
+// to the state and persists it. The state is rolled back if the block cannot
+// be stored.
+func (bc *Blockchain) connectBlock(b *block.Block) error {
+	height := len(bc.chain)
+
+	var err error
+	if height == 0 {
+		err = bc.checkGenesis(b)
+	} else {
+		err = bc.validateBlock(bc.state, bc.chain, b)
+	}
+
+	if err == nil {
+		err = bc.state.applyBlock(b, height)
+	}
+
+	if err != nil {
+		return &ValidationError{Height: height, Err: err}
+	}
+
+	if err := bc.store.AppendBlock(b); err != nil {
+		if undoErr := bc.state.undoBlock(b, height); undoErr != nil {
+			log.Printf("ERROR: %v", undoErr)
+		}
+		return err
+	}
+
 	bc.chain = append(bc.chain, b)
-	bc.transactionPool = []*transaction.Transaction{}
+	bc.transactionPool.RemoveBlock(b)
+	bc.pruneTransactionPool()
+
+	return nil
+}
+
+// LastBlock returns the tip of the chain.
+func (bc *Blockchain) LastBlock() *block.Block {
+	bc.Lock()
+	defer bc.Unlock()
+
+	return bc.tip()
+}
+
+// tip is LastBlock for callers that already hold the chain lock.
+func (bc *Blockchain) tip() *block.Block {
+	return bc.chain[len(bc.chain)-1]
+}
+
+// VerifyTransactionSignature checks the signature carried by the transaction
+// against its signing bytes and the sender public key it carries.
+func (bc *Blockchain) VerifyTransactionSignature(t *transaction.Transaction) bool {
+	// Only one encoding of a key and a signature is accepted, since both are
+	// part of the transaction hash.
+	if len(t.SenderPublicKey) != 128 || !isLowerHex(t.SenderPublicKey) ||
+		len(t.Signature) != 128 || !isLowerHex(t.Signature) {
+		return false
+	}
+
+	publicKey := wallet.PublicKeyFromString(t.SenderPublicKey)
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return false
+	}
+
+	s := wallet.SignatureFromString(t.Signature)
+	if !s.IsLowS() {
+		return false
+	}
+	h := sha256.Sum256(t.SigningBytes())
+
+	return ecdsa.Verify(publicKey, h[:], s.R, s.S)
+}
+
+// verifyTransaction checks that a transaction other than a coinbase is signed
+// by the owner of the sender address.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (bc *Blockchain) verifyTransaction(t *transaction.Transaction) error {
+	if !bc.VerifyTransactionSignature(t) {
+		return ErrInvalidSignature
+	}
+
+	publicKey := wallet.PublicKeyFromString(t.SenderPublicKey)
+	if wallet.BlockchainAddressFromPublicKey(publicKey) != t.SenderBlockchainAddress {
+		return ErrPublicKeyMismatch
+	}
+
+	return nil
+}
+
+func (bc *Blockchain) CreateTransaction(t *transaction.Transaction) error {
+	if err := bc.AddTransaction(t); err != nil {
+		return err
+	}
 
 	for _, n := range bc.neighbors {
+		bt := &breq.TransactionRequest{
+			SenderBlockchainAddress: &t.SenderBlockchainAddress,
+			SenderPublicKey:         &t.SenderPublicKey,
+			Nonce:                   &t.Nonce,
+			Fee:                     &t.Fee,
+			Inputs:                  &t.Inputs,
+			Outputs:                 &t.Outputs,
+			Signature:               &t.Signature,
+		}
+
+		m, _ := json.Marshal(bt)
+		buf := bytes.NewBuffer(m)
 		endpoint := fmt.Sprintf("http://%s/transactions", n)
 		client := &http.Client{}
 
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
+		req, _ := http.NewRequest("PUT", endpoint, buf)
 		client.Do(req)
 	}
-	return b
+
+	return nil
 }
 
-func (bc *Blockchain) LastBlock() *block.Block {
-	return bc.chain[len(bc.chain)-1]
+// AddTransaction admits a signed transaction into the pool. Its nonce must be
+// the sender's next one after the chain and the pool, every input must be an
+// unspent output owned by the sender that no pooled transaction spends yet,
+// and the outputs plus the fee must be covered both by the inputs and by the
+// sender's confirmed balance minus what the pool already spends of it.
+// The returned error tells which of the checks failed.
+func (bc *Blockchain) AddTransaction(t *transaction.Transaction) error {
+	bc.Lock()
+	defer bc.Unlock()
+
+	err := bc.checkTransaction(t)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return err
+	}
+
+	bc.transactionPool.Expire(time.Now())
+
+	if err := bc.transactionPool.Add(t); err != nil {
+		log.Printf("ERROR: %v", err)
+		return err
+	}
+	bc.saveTransactionPool()
+
+	return nil
 }
 
-func (bc *Blockchain) VerifyTransactionSignature(
-	senderPublicKey *ecdsa.PublicKey,
-	s *wallet.Signature,
-	t *transaction.Transaction,
-) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256(m)
-
-	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
-}
-
-func (bc *Blockchain) CreateTransaction(
-	sender string,
-	recipient string,
-	value float32,
-	senderPublicKey *ecdsa.PublicKey,
-	s *wallet.Signature,
-) bool {
-	isTransacted := bc.AddTransaction(
-		sender,
-		recipient,
-		value,
-		senderPublicKey,
-		s,
-	)
+func (bc *Blockchain) checkTransaction(t *transaction.Transaction) error {
+	if !wellFormed(t) {
+		return ErrMalformedTransaction
+	}
 
-	if isTransacted {
-		for _, n := range bc.neighbors {
-			publicKey := fmt.Sprintf(
-				"%\064x%\064x",
-				senderPublicKey.X.Bytes(),
-				senderPublicKey.Y.Bytes(),
-			)
-			signatureStr := s.String()
-			bt := &breq.TransactionRequest{
-				SenderBlockchainAddress:    &sender,
-				RecipientBlockchainAddress: &recipient,
-				SenderPublicKey:            &publicKey,
-				Value:                      &value,
-				Signature:                  &signatureStr,
-			}
+	if t.SenderBlockchainAddress == MINING_SENDER || t.IsCoinbase() {
+		return ErrCoinbaseTransaction
+	}
+
+	if _, ok := bc.transactionPool.Get(t.Hash()); ok {
+		return mempool.ErrDuplicate
+	}
+
+	if err := bc.verifyTransaction(t); err != nil {
+		return err
+	}
+
+	if t.Nonce != bc.nextNonce(t.SenderBlockchainAddress) {
+		return ErrInvalidNonce
+	}
+
+	if len(t.Inputs) == 0 || len(t.Outputs) == 0 {
+		return ErrEmptyTransaction
+	}
 
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", n)
-			client := &http.Client{}
+	var outputValue amount.Amount = 0
+	for _, o := range t.Outputs {
+		if o.Value <= 0 || !o.Value.Valid() {
+			return ErrInvalidValue
+		}
 
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			client.Do(req)
+		outputValue += o.Value
+		if !outputValue.Valid() {
+			return ErrInvalidValue
 		}
 	}
 
-	return isTransacted
+	if !t.Fee.Valid() {
+		return ErrInvalidFee
+	}
+
+	pending := bc.pendingSpends()
+	spent := make(map[utxo.Outpoint]bool)
+	var inputValue amount.Amount = 0
+
+	for _, i := range t.Inputs {
+		op := utxo.Outpoint{Hash: i.PreviousHash, Index: i.Index}
+
+		e, ok := bc.state.utxos.Get(op)
+		if !ok {
+			return ErrUnknownInput
+		}
+
+		if e.Output.BlockchainAddress != t.SenderBlockchainAddress {
+			return ErrInputNotOwned
+		}
+
+		if !mature(e, len(bc.chain)) {
+			return ErrImmatureCoinbase
+		}
+
+		if pending[op] || spent[op] {
+			return ErrDoubleSpend
+		}
+
+		spent[op] = true
+		inputValue += e.Output.Value
+	}
+
+	// The inputs are confirmed outputs of the sender that no pooled
+	// transaction spends, so this also keeps the sender within the balance
+	// left after its pending transactions.
+	if outputValue+t.Fee > inputValue {
+		return ErrInputsTooLow
+	}
+
+	return nil
 }
-func (bc *Blockchain) AddTransaction(
-	sender string,
-	recipient string,
-	value float32,
-	senderPublicKey *ecdsa.PublicKey,
-	s *wallet.Signature,
-) bool {
-	t := transaction.NewTransaction(sender, recipient, value)
 
-	if sender == MINING_SENDER {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+// wellFormed reports whether the transaction and all its inputs and outputs
+// are present, so that the other checks can dereference them.
+func wellFormed(t *transaction.Transaction) bool {
+	if t == nil {
+		return false
 	}
 
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		// if bc.CalculateTotalAmount(sender) < value {
-		// 	log.Println("ERROR: Not enough balance in a wallet")
-		// 	return false
-		// }
-		bc.transactionPool = append(bc.transactionPool, t)
+	for _, i := range t.Inputs {
+		if i == nil {
+			return false
+		}
+	}
+
+	for _, o := range t.Outputs {
+		if o == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mature reports whether the entry may be spent in a block at height. A
+// coinbase output needs COINBASE_MATURITY blocks on top of its own, since a
+// reorg would take it away; the genesis allocations can never be reorged.
+func mature(e *utxo.Entry, height int) bool {
+	if !e.Coinbase || e.Height == 0 {
 		return true
 	}
 
-	log.Println("ERROR: Verify Transaction")
-	return false
+	return height-e.Height > COINBASE_MATURITY
+}
+
+// NextNonce returns the nonce the sender's next transaction must carry,
+// counting both confirmed and pooled transactions.
+func (bc *Blockchain) NextNonce(blockchainAddress string) uint64 {
+	bc.Lock()
+	defer bc.Unlock()
+
+	return bc.nextNonce(blockchainAddress)
+}
+
+func (bc *Blockchain) nextNonce(blockchainAddress string) uint64 {
+	nonce := bc.state.accounts.Nonce(blockchainAddress)
+
+	for _, t := range bc.TransactionPool() {
+		if t.SenderBlockchainAddress == blockchainAddress && t.Nonce == nonce {
+			nonce += 1
+		}
+	}
+
+	return nonce
+}
+
+// pendingSpends returns the outpoints already spent by pooled transactions.
+func (bc *Blockchain) pendingSpends() map[utxo.Outpoint]bool {
+	spent := make(map[utxo.Outpoint]bool)
+
+	for _, t := range bc.TransactionPool() {
+		for _, i := range t.Inputs {
+			spent[utxo.Outpoint{Hash: i.PreviousHash, Index: i.Index}] = true
+		}
+	}
+
+	return spent
 }
 
 func (bc *Blockchain) CopyTransactionPool() []*transaction.Transaction {
 	transactions := make([]*transaction.Transaction, 0)
 
-	for _, t := range bc.transactionPool {
+	for _, t := range bc.TransactionPool() {
 		transactions = append(transactions, transaction.NewTransaction(
 			t.SenderBlockchainAddress,
-			t.RecipientBlockchainAddress,
-			t.Value,
+			t.SenderPublicKey,
+			t.Nonce,
+			t.Fee,
+			t.Inputs,
+			t.Outputs,
+			t.Signature,
 		))
 	}
 
 	return transactions
 }
 
-func (bc *Blockchain) ValidProof(nonce int, previousHash [32]byte, transactions []*transaction.Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
+func (bc *Blockchain) ValidProof(b *block.Block) bool {
+	return pow.CheckProofOfWork(b.Hash(), b.Bits)
+}
+
+// NewBlockTemplate assembles the next block from the pooled transactions,
+// ordered by SelectTransactions, and a coinbase paying the miner the
+// BlockReward plus their fees. Its nonce still has to be found by ProofOfWork.
+// Transactions that do not fit within MAX_BLOCK_SIZE and
+// MAX_BLOCK_TRANSACTIONS stay in the pool for a later block.
+func (bc *Blockchain) NewBlockTemplate() *block.Block {
+	bc.transactionPool.Expire(time.Now())
+
+	// The size of the block without pooled transactions, with the widest
+	// nonce and coinbase value it could end up with.
+	empty := block.NewBlock(
+		math.MaxInt64,
+		len(bc.chain),
+		bc.tip().Hash(),
+		bc.NextBits(bc.chain),
+		[]*transaction.Transaction{transaction.NewCoinbaseTransaction(
+			MINING_SENDER,
+			bc.blockchainAddress,
+			amount.MAX_AMOUNT,
+			len(bc.chain),
+		)},
+	)
+	selected := bc.SelectTransactions(MAX_BLOCK_SIZE-empty.Size(), MAX_BLOCK_TRANSACTIONS-1)
 
-	guessBlock := block.Block{
-		Timestamp:    0,
-		Nonce:        nonce,
-		PreviousHash: previousHash,
-		Transactions: transactions,
+	var fees amount.Amount = 0
+	for _, t := range selected {
+		fees += t.Fee
 	}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
 
-	return guessHashStr[:difficulty] == zeros
-}
+	coinbase := transaction.NewCoinbaseTransaction(
+		MINING_SENDER,
+		bc.blockchainAddress,
+		bc.BlockReward(len(bc.chain))+fees,
+		len(bc.chain),
+	)
+	transactions := append([]*transaction.Transaction{coinbase}, selected...)
 
-func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	previousHash := bc.LastBlock().Hash()
-	nonce := 0
+	b := block.NewBlock(0, len(bc.chain), bc.tip().Hash(), bc.NextBits(bc.chain), transactions)
 
-	for !bc.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
+	// A clock behind the median time past would make the block invalid.
+	if mtp := medianTimePast(bc.chain); b.Timestamp <= mtp {
+		b.Timestamp = mtp + 1
 	}
 
-	return nonce
+	return b
 }
 
-func (bc *Blockchain) ValidChain(chain []*block.Block) bool {
-	preBlock := chain[0]
-	currentIndex := 1
+// SelectTransactions orders the pooled transactions by fee rate, highest
+// first. A transaction is only taken once every earlier nonce of its sender
+// has been taken, so a high fee can pull its sender's cheaper predecessors
+// ahead but never reorder them. The selection takes at most count
+// transactions adding at most size bytes to the serialized block; a
+// transaction that does not fit is passed over, and so are the later ones of
+// its sender.
+func (bc *Blockchain) SelectTransactions(size int, count int) []*transaction.Transaction {
+	candidates := bc.CopyTransactionPool()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].FeeRate() > candidates[j].FeeRate()
+	})
 
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
+	selected := make([]*transaction.Transaction, 0, len(candidates))
+	nonces := make(map[string]uint64)
 
-		if b.PreviousHash != preBlock.Hash() {
-			return false
+	for len(candidates) > 0 && len(selected) < count {
+		taken := -1
+
+		for i, t := range candidates {
+			nonce, ok := nonces[t.SenderBlockchainAddress]
+			if !ok {
+				nonce = bc.state.accounts.Nonce(t.SenderBlockchainAddress)
+			}
+
+			if t.Nonce == nonce {
+				taken = i
+				break
+			}
 		}
 
-		isValidBlock := bc.ValidProof(
-			b.Nonce,
-			b.PreviousHash,
-			b.Transactions,
-			MINING_DIFFICULTY,
-		)
+		if taken < 0 {
+			break
+		}
 
-		if !isValidBlock {
-			return false
+		t := candidates[taken]
+		candidates = append(candidates[:taken], candidates[taken+1:]...)
+
+		// One more byte for the separator in the transaction list.
+		if t.Size()+1 > size {
+			continue
 		}
+		size -= t.Size() + 1
 
-		preBlock = b
-		currentIndex += 1
+		selected = append(selected, t)
+		nonces[t.SenderBlockchainAddress] = t.Nonce + 1
 	}
 
-	return true
+	return selected
 }
 
-func (bc *Blockchain) ResolveConflicts() bool {
-	var longestChain []*block.Block = nil
-	maxLength := len(bc.chain)
+// ProofOfWork searches the nonce of the block. The header is encoded once and
+// only its nonce is rewritten between attempts.
+func (bc *Blockchain) ProofOfWork(b *block.Block) {
+	header := b.HeaderBytes()
+	target := pow.Target(b.Bits)
+	nonce := 0
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/chain", n)
-		resp, _ := http.Get(endpoint)
+	for {
+		block.PutHeaderNonce(header, nonce)
+		if pow.CheckHash(sha256.Sum256(header), target) {
+			break
+		}
+		nonce += 1
+	}
 
-		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			_ = decoder.Decode(&bcResp)
+	b.Nonce = nonce
+}
 
-			chain := bcResp.Chain()
+// ResolveConflicts syncs with every neighbor in turn, headers first and
+// from the fork point on, and reorganizes onto a neighbor chain when it has
+// more cumulative work than the local one. Ties are broken by the lower tip
+// hash.
+func (bc *Blockchain) ResolveConflicts() bool {
+	replaced := false
 
-			if len(chain) > maxLength && bc.ValidChain(chain) {
-				maxLength = len(chain)
-				longestChain = chain
-			}
+	for _, n := range bc.Neighbors() {
+		synced, err := bc.syncFrom(n)
+		if err != nil {
+			log.Printf("ERROR: chain from %s: %v", n, err)
+			continue
 		}
+
+		replaced = replaced || synced
 	}
 
-	if longestChain != nil {
-		bc.chain = longestChain
+	if replaced {
 		log.Printf("Resolve conflicts: chain replaced")
 		return true
 	}
@@ -292,31 +668,31 @@ func (bc *Blockchain) ResolveConflicts() bool {
 	return false
 }
 
+// Mining mines a block on top of the tip and announces it to the
+// neighbors. The lock is released before the announcement, so that a
+// neighbor announcing its own block at the same time is not kept waiting.
 func (bc *Blockchain) Mining() bool {
-	bc.Lock()
-	defer bc.Unlock()
-
-	if len(bc.transactionPool) == 0 {
+	b := bc.mineBlock()
+	if b == nil {
 		return false
 	}
+	log.Println("action=mining, status=success")
 
-	bc.AddTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD, nil, nil)
+	bc.announceBlock(b, "")
 
-	nonce := bc.ProofOfWork()
-	previousHash := bc.LastBlock().Hash()
+	return true
+}
 
-	bc.CreateBlock(nonce, previousHash)
-	log.Println("action=mining, status=success")
+// mineBlock mines and connects the next block under the lock. It returns
+// nil if the block could not be connected.
+func (bc *Blockchain) mineBlock() *block.Block {
+	bc.Lock()
+	defer bc.Unlock()
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/consensus", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("PUT", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
-	}
+	b := bc.NewBlockTemplate()
+	bc.ProofOfWork(b)
 
-	return true
+	return bc.CreateBlock(b)
 }
 
 func (bc *Blockchain) StartMining() {
@@ -324,17 +700,83 @@ func (bc *Blockchain) StartMining() {
 	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
 }
 
-func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
-	var total float32 = 0.0
+// MerkleProof finds the block containing the transaction and returns it
+// together with the Merkle branch of the transaction, both taken from the
+// same chain.
+func (bc *Blockchain) MerkleProof(transactionHash [32]byte) (*block.Block, []*block.MerkleStep, bool) {
+	bc.Lock()
+	defer bc.Unlock()
+
+	height, ok := bc.state.transactionHeight(transactionHash)
+	if !ok {
+		return nil, nil, false
+	}
+
+	b := bc.chain[height]
+	branch, ok := b.MerkleProof(transactionHash)
+	return b, branch, ok
+}
+
+// FindTransaction looks the transaction up in the chain and then in the
+// pool. The height is -1 for a transaction that is still pending.
+func (bc *Blockchain) FindTransaction(transactionHash [32]byte) (*transaction.Transaction, int, bool) {
+	bc.Lock()
+	defer bc.Unlock()
 
-	for _, b := range bc.chain {
-		for _, t := range b.Transactions {
-			if t.SenderBlockchainAddress == blockchainAddress {
-				total -= t.Value
+	if height, ok := bc.state.transactionHeight(transactionHash); ok {
+		for _, t := range bc.chain[height].Transactions {
+			if t.Hash() == transactionHash {
+				return t, height, true
 			}
+		}
+	}
+
+	if t, ok := bc.transactionPool.Get(transactionHash); ok {
+		return t, -1, true
+	}
+
+	return nil, 0, false
+}
+
+// Confirmations is the number of blocks on top of and including the block at
+// the given height, or 0 if the chain no longer reaches it.
+func (bc *Blockchain) Confirmations(height int) int {
+	bc.Lock()
+	defer bc.Unlock()
+
+	if height < 0 || height >= len(bc.chain) {
+		return 0
+	}
+
+	return len(bc.chain) - height
+}
+
+func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) amount.Amount {
+	bc.Lock()
+	defer bc.Unlock()
 
-			if t.RecipientBlockchainAddress == blockchainAddress {
-				total += t.Value
+	return bc.state.accounts.Balance(blockchainAddress)
+}
+
+// CalculatePendingAmount is the confirmed balance adjusted by the pooled
+// transactions that pay to or spend from the address.
+func (bc *Blockchain) CalculatePendingAmount(blockchainAddress string) amount.Amount {
+	bc.Lock()
+	defer bc.Unlock()
+
+	total := bc.state.accounts.Balance(blockchainAddress)
+
+	for _, t := range bc.TransactionPool() {
+		for _, i := range t.Inputs {
+			e, ok := bc.state.utxos.Get(utxo.Outpoint{Hash: i.PreviousHash, Index: i.Index})
+			if ok && e.Output.BlockchainAddress == blockchainAddress {
+				total -= e.Output.Value
+			}
+		}
+
+		for _, o := range t.Outputs {
+			if o.BlockchainAddress == blockchainAddress {
+				total += o.Value
 			}
 		}
 	}
@@ -342,6 +784,59 @@ func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
 	return total
 }
 
+// UnspentOutputs returns the outputs of the address that the next block
+// could spend: confirmed, mature and not yet spent by a pooled transaction.
+func (bc *Blockchain) UnspentOutputs(blockchainAddress string) []*utxo.Entry {
+	bc.Lock()
+	defer bc.Unlock()
+
+	pending := bc.pendingSpends()
+	entries := make([]*utxo.Entry, 0)
+
+	for _, e := range bc.state.utxos.FindByAddress(blockchainAddress) {
+		if !pending[e.Outpoint] && mature(e, len(bc.chain)) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// pruneTransactionPool drops pooled transactions that spend outputs which
+// are no longer unspent or no longer continue their sender's nonce sequence,
+// e.g. because a block confirmed a conflicting transaction of the sender.
+func (bc *Blockchain) pruneTransactionPool() {
+	nonces := make(map[string]uint64)
+	spent := make(map[utxo.Outpoint]bool)
+
+	bc.transactionPool.Retain(func(t *transaction.Transaction) bool {
+		nonce, ok := nonces[t.SenderBlockchainAddress]
+		if !ok {
+			nonce = bc.state.accounts.Nonce(t.SenderBlockchainAddress)
+		}
+
+		if t.Nonce != nonce {
+			return false
+		}
+
+		for _, i := range t.Inputs {
+			op := utxo.Outpoint{Hash: i.PreviousHash, Index: i.Index}
+			if _, ok := bc.state.utxos.Get(op); !ok || spent[op] {
+				return false
+			}
+		}
+
+		for _, i := range t.Inputs {
+			spent[utxo.Outpoint{Hash: i.PreviousHash, Index: i.Index}] = true
+		}
+		nonces[t.SenderBlockchainAddress] = nonce + 1
+
+		return true
+	})
+
+	bc.saveTransactionPool()
+}
+
 func (bc *Blockchain) Print() {
 	for i, block := range bc.chain {
 		fmt.Printf(
@@ -359,7 +854,7 @@ func (bc *Blockchain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Blocks []*block.Block `json:"chain"`
 	}{
-		Blocks: bc.chain,
+		Blocks: bc.Chain(),
 	})
 }
 
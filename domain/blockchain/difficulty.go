@@ -0,0 +1,54 @@
+package blockchain
+
+import (
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"math/big"
+	"time"
+)
+
+const (
+	DIFFICULTY_ADJUSTMENT_INTERVAL = 10
+	TARGET_BLOCK_TIME_SEC          = MINING_TIMER_SEC
+	MAX_RETARGET_FACTOR            = 4
+)
+
+// NextBits returns the target the block following chain must be mined at.
+// It only changes every DIFFICULTY_ADJUSTMENT_INTERVAL blocks: the previous
+// target is scaled by how long the last interval took compared with
+// TARGET_BLOCK_TIME_SEC per block, by at most MAX_RETARGET_FACTOR either way
+// and never above the proof-of-work limit.
+func (bc *Blockchain) NextBits(chain []*block.Block) uint32 {
+	height := len(chain)
+
+	if height == 0 {
+		return bc.genesis.Bits
+	}
+
+	last := chain[height-1]
+	if height%DIFFICULTY_ADJUSTMENT_INTERVAL != 0 {
+		return last.Bits
+	}
+
+	first := chain[height-DIFFICULTY_ADJUSTMENT_INTERVAL]
+	actual := last.Timestamp - first.Timestamp
+	expected := int64(DIFFICULTY_ADJUSTMENT_INTERVAL-1) * TARGET_BLOCK_TIME_SEC * int64(time.Second)
+
+	if actual < expected/MAX_RETARGET_FACTOR {
+		actual = expected / MAX_RETARGET_FACTOR
+	}
+
+	if actual > expected*MAX_RETARGET_FACTOR {
+		actual = expected * MAX_RETARGET_FACTOR
+	}
+
+	target := pow.CompactToBig(last.Bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+
+	if target.Cmp(pow.PowLimit) > 0 {
+		target.Set(pow.PowLimit)
+	}
+
+	return pow.BigToCompact(target)
+}
@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"goblockchain/domain/transaction"
+	"os"
+)
+
+// GENESIS_TIMESTAMP is the timestamp of the default genesis block.
+const GENESIS_TIMESTAMP int64 = 1700000000 * 1000000000
+
+var ErrInvalidGenesisSpec = errors.New("invalid genesis spec")
+
+// GenesisSpec describes the genesis block of a network, so that every node
+// of the network starts from the same block. Bits is the initial target and
+// Allocations are paid out by the genesis coinbase.
+type GenesisSpec struct {
+	Timestamp   int64
+	Bits        uint32
+	Allocations []*transaction.Output
+}
+
+// DefaultGenesisSpec is used when no spec is given: no allocations and the
+// MINING_BITS target.
+func DefaultGenesisSpec() *GenesisSpec {
+	return &GenesisSpec{
+		Timestamp:   GENESIS_TIMESTAMP,
+		Bits:        MINING_BITS,
+		Allocations: []*transaction.Output{},
+	}
+}
+
+// LoadGenesisSpec reads a spec such as
+//
+//	{
+//	  "timestamp": 1700000000000000000,
+//	  "bits": 521142271,
+//	  "allocations": [
+//	    {"blockchain_address": "1Fy...", "value": 100000000000}
+//	  ]
+//	}
+//
+// where the timestamp is in nanoseconds and the values are in base units.
+func LoadGenesisSpec(path string) (*GenesisSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &GenesisSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func (gs *GenesisSpec) Validate() error {
+	if gs.Timestamp <= 0 {
+		return ErrInvalidGenesisSpec
+	}
+
+	target := pow.CompactToBig(gs.Bits)
+	if target.Sign() <= 0 || target.Cmp(pow.PowLimit) > 0 {
+		return ErrInvalidGenesisSpec
+	}
+
+	var total amount.Amount = 0
+	for _, a := range gs.Allocations {
+		total += a.Value
+		if a.BlockchainAddress == "" || a.Value <= 0 || !a.Value.Valid() || total > MAX_SUPPLY {
+			return ErrInvalidGenesisSpec
+		}
+	}
+
+	return nil
+}
+
+// Block builds the genesis block of the spec. It is not mined. If there are
+// allocations, its only transaction is a coinbase paying them.
+func (gs *GenesisSpec) Block() *block.Block {
+	transactions := []*transaction.Transaction{}
+
+	if len(gs.Allocations) > 0 {
+		outputs := make([]*transaction.Output, len(gs.Allocations))
+		for i, a := range gs.Allocations {
+			outputs[i] = transaction.NewOutput(a.BlockchainAddress, a.Value)
+		}
+
+		transactions = append(transactions, transaction.NewTransaction(
+			MINING_SENDER,
+			"",
+			0,
+			0,
+			[]*transaction.Input{transaction.NewInput([32]byte{}, 0)},
+			outputs,
+			"",
+		))
+	}
+
+	return &block.Block{
+		Timestamp:    gs.Timestamp,
+		Height:       0,
+		PreviousHash: (&block.Block{}).Hash(),
+		MerkleRoot:   block.MerkleRoot(transactions),
+		Bits:         gs.Bits,
+		Transactions: transactions,
+	}
+}
+
+func (gs *GenesisSpec) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Timestamp   *int64                 `json:"timestamp"`
+		Bits        *uint32                `json:"bits"`
+		Allocations *[]*transaction.Output `json:"allocations"`
+	}{
+		Timestamp:   &gs.Timestamp,
+		Bits:        &gs.Bits,
+		Allocations: &gs.Allocations,
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	breq "goblockchain/blockchain_server/pkg/dto/blockchain_requests"
+	"goblockchain/blockchain_server/pkg/utils"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	MAX_ORPHAN_BLOCKS       = 100
+	MAX_ANCESTOR_FETCHES    = 100
+	BLOCK_FETCH_TIMEOUT_SEC = 5
+)
+
+var (
+	ErrKnownBlock  = errors.New("block is already known")
+	ErrOrphanBlock = errors.New("block is kept as an orphan until its branch wins")
+)
+
+// orphanPool keeps blocks whose parent is not in the chain: blocks that
+// arrived before their parent, and blocks of side branches that may still
+// overtake the chain.
+type orphanPool struct {
+	blocks map[[32]byte]*block.Block
+	order  [][32]byte
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks: make(map[[32]byte]*block.Block),
+	}
+}
+
+func (op *orphanPool) add(b *block.Block) {
+	hash := b.Hash()
+	if _, ok := op.blocks[hash]; ok {
+		return
+	}
+
+	op.blocks[hash] = b
+	op.order = append(op.order, hash)
+
+	for len(op.order) > MAX_ORPHAN_BLOCKS {
+		op.remove(op.order[0])
+	}
+}
+
+func (op *orphanPool) get(hash [32]byte) (*block.Block, bool) {
+	b, ok := op.blocks[hash]
+	return b, ok
+}
+
+func (op *orphanPool) remove(hash [32]byte) {
+	if _, ok := op.blocks[hash]; !ok {
+		return
+	}
+
+	delete(op.blocks, hash)
+	for i, h := range op.order {
+		if h == hash {
+			op.order = append(op.order[:i], op.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// child returns an orphan whose parent is the block with the given hash.
+func (op *orphanPool) child(hash [32]byte) (*block.Block, bool) {
+	for _, h := range op.order {
+		if b := op.blocks[h]; b.PreviousHash == hash {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// ReceiveBlock handles a block announced by the node at origin. Blocks
+// without a valid proof of work are rejected outright. A block on top of the
+// tip extends the chain. Any other block is kept in the orphan pool and its
+// branch is followed back to the chain, fetching the ancestors that are
+// missing from origin if origin is a neighbor; if the branch then has more
+// work than the chain, the node reorganizes onto it. Accepted blocks are
+// relayed to the other neighbors.
+func (bc *Blockchain) ReceiveBlock(b *block.Block, origin string) error {
+	err := bc.receiveBlock(b, origin)
+	if err == nil {
+		bc.announceBlock(b, origin)
+	}
+
+	return err
+}
+
+// receiveBlock fetches the missing ancestors of the block without the lock,
+// and then accepts the block under the lock, which is released even if
+// accepting it panics.
+func (bc *Blockchain) receiveBlock(b *block.Block, origin string) error {
+	if !pow.CheckProofOfWork(b.Hash(), b.Bits) {
+		return ErrProofOfWork
+	}
+
+	if err := bc.fetchAncestors(b, origin); err != nil {
+		return err
+	}
+
+	bc.Lock()
+	defer bc.Unlock()
+
+	return bc.acceptBlock(b)
+}
+
+func (bc *Blockchain) acceptBlock(b *block.Block) error {
+	hash := b.Hash()
+
+	if _, ok := bc.state.blockHeight(hash); ok {
+		return ErrKnownBlock
+	}
+
+	if b.PreviousHash == bc.tip().Hash() {
+		if err := bc.connectBlock(b); err != nil {
+			return err
+		}
+
+		bc.orphans.remove(hash)
+		bc.connectOrphans()
+		return nil
+	}
+
+	bc.orphans.add(b)
+
+	branch, ok := bc.orphanBranch(b)
+	if !ok {
+		return ErrOrphanBlock
+	}
+
+	// Blocks that arrived before b may continue its branch.
+	for {
+		next, ok := bc.orphans.child(branch[len(branch)-1].Hash())
+		if !ok {
+			break
+		}
+		branch = append(branch, next)
+	}
+
+	fork, _ := bc.state.blockHeight(branch[0].PreviousHash)
+	candidate := make([]*block.Block, 0, fork+1+len(branch))
+	candidate = append(candidate, bc.chain[:fork+1]...)
+	candidate = append(candidate, branch...)
+
+	newTip := candidate[len(candidate)-1].Hash()
+	if !isBetterChain(chainWork(candidate), newTip, bc.state.work, bc.tip().Hash()) {
+		return ErrOrphanBlock
+	}
+
+	if err := bc.reorganize(candidate); err != nil {
+		for _, ob := range branch {
+			bc.orphans.remove(ob.Hash())
+		}
+		return err
+	}
+
+	for _, ob := range branch {
+		bc.orphans.remove(ob.Hash())
+	}
+
+	return nil
+}
+
+// connectOrphans extends the chain with orphans that continue its tip.
+func (bc *Blockchain) connectOrphans() {
+	for {
+		next, ok := bc.orphans.child(bc.tip().Hash())
+		if !ok {
+			return
+		}
+
+		bc.orphans.remove(next.Hash())
+		if err := bc.connectBlock(next); err != nil {
+			log.Printf("ERROR: %v", err)
+			return
+		}
+	}
+}
+
+// orphanBranch follows the parents of b through the orphan pool until it
+// reaches a block of the chain. It returns the branch oldest first, without
+// the block of the chain, or false if an ancestor is missing.
+func (bc *Blockchain) orphanBranch(b *block.Block) ([]*block.Block, bool) {
+	branch := []*block.Block{b}
+
+	for {
+		parent := branch[0].PreviousHash
+		if _, ok := bc.state.blockHeight(parent); ok {
+			return branch, true
+		}
+
+		pb, ok := bc.orphans.get(parent)
+		if !ok {
+			return nil, false
+		}
+
+		branch = append([]*block.Block{pb}, branch...)
+	}
+}
+
+// fetchAncestors fetches the ancestors of b that are neither in the chain nor
+// in the orphan pool from origin and adds them to the orphan pool. Only
+// neighbors are asked, and the lock is only held to look blocks up, not
+// while waiting for origin.
+func (bc *Blockchain) fetchAncestors(b *block.Block, origin string) error {
+	if !bc.isNeighbor(origin) {
+		return nil
+	}
+
+	parent := b.PreviousHash
+
+	for fetches := 0; ; {
+		bc.Lock()
+		_, known := bc.state.blockHeight(parent)
+		pb, pooled := bc.orphans.get(parent)
+		bc.Unlock()
+
+		if known {
+			return nil
+		}
+
+		if !pooled {
+			if fetches >= MAX_ANCESTOR_FETCHES {
+				return ErrOrphanBlock
+			}
+			fetches += 1
+
+			var err error
+			pb, err = fetchBlock(origin, parent)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				return ErrOrphanBlock
+			}
+
+			if pb.Hash() != parent {
+				return fmt.Errorf("fetched block %x has hash %x", parent, pb.Hash())
+			}
+
+			if !pow.CheckProofOfWork(pb.Hash(), pb.Bits) {
+				return ErrProofOfWork
+			}
+
+			bc.Lock()
+			bc.orphans.add(pb)
+			bc.Unlock()
+		}
+
+		parent = pb.PreviousHash
+	}
+}
+
+func (bc *Blockchain) isNeighbor(host string) bool {
+	for _, n := range bc.Neighbors() {
+		if n == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchBlock gets the block with the given hash from the node at host.
+func fetchBlock(host string, hash [32]byte) (*block.Block, error) {
+	client := &http.Client{Timeout: BLOCK_FETCH_TIMEOUT_SEC * time.Second}
+
+	endpoint := fmt.Sprintf("http://%s/blocks/hash/%x", host, hash)
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch block %x from %s: status %d", hash, host, resp.StatusCode)
+	}
+
+	b := new(block.Block)
+	if err := json.NewDecoder(resp.Body).Decode(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// announceBlock pushes the block to every neighbor but the one it came
+// from.
+func (bc *Blockchain) announceBlock(b *block.Block, except string) {
+	origin := fmt.Sprintf("%s:%d", utils.GetHost(), bc.port)
+
+	m, _ := json.Marshal(&breq.BlockRequest{
+		Block:  b,
+		Origin: &origin,
+	})
+
+	for _, n := range bc.neighbors {
+		if n == except {
+			continue
+		}
+
+		endpoint := fmt.Sprintf("http://%s/blocks", n)
+		client := &http.Client{Timeout: BLOCK_FETCH_TIMEOUT_SEC * time.Second}
+
+		resp, err := client.Post(endpoint, "application/json", bytes.NewBuffer(m))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+	"log"
+	"time"
+)
+
+// MAX_REORG_EVENTS is how many of the most recent reorgs are remembered.
+const MAX_REORG_EVENTS = 100
+
+// ReorgEvent records a switch to another branch. Depth is the number of
+// local blocks that were abandoned, Attached the number of blocks of the new
+// branch that replaced them.
+type ReorgEvent struct {
+	Time       time.Time
+	ForkHeight int
+	Depth      int
+	Attached   int
+	OldTip     [32]byte
+	NewTip     [32]byte
+	Reinjected int
+}
+
+func (e *ReorgEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time       int64  `json:"time"`
+		ForkHeight int    `json:"fork_height"`
+		Depth      int    `json:"depth"`
+		Attached   int    `json:"attached"`
+		OldTip     string `json:"old_tip"`
+		NewTip     string `json:"new_tip"`
+		Reinjected int    `json:"reinjected"`
+	}{
+		Time:       e.Time.UnixNano(),
+		ForkHeight: e.ForkHeight,
+		Depth:      e.Depth,
+		Attached:   e.Attached,
+		OldTip:     fmt.Sprintf("%x", e.OldTip),
+		NewTip:     fmt.Sprintf("%x", e.NewTip),
+		Reinjected: e.Reinjected,
+	})
+}
+
+// Reorgs returns the recorded reorgs, oldest first.
+func (bc *Blockchain) Reorgs() []*ReorgEvent {
+	bc.Lock()
+	defer bc.Unlock()
+
+	return bc.reorgs
+}
+
+// commonAncestor returns the height of the last block the two chains share,
+// or -1 if they do not even share the genesis block.
+func commonAncestor(a, b []*block.Block) int {
+	height := -1
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Hash() != b[i].Hash() {
+			break
+		}
+		height = i
+	}
+
+	return height
+}
+
+// reorganize switches the local chain to chain. The blocks after the common
+// ancestor are undone from the state, the blocks of the new branch are
+// validated and applied on top of it, and the transactions only the
+// abandoned blocks confirmed go back to the pool. If any block of the new
+// branch is invalid, the local chain is restored and a *ValidationError is
+// returned.
+func (bc *Blockchain) reorganize(chain []*block.Block) error {
+	fork := commonAncestor(bc.chain, chain)
+	if fork < 0 {
+		return &ValidationError{Height: 0, Err: ErrGenesisMismatch}
+	}
+
+	// The shared prefix is taken from the local chain, which is already
+	// valid, rather than from the peer.
+	newChain := make([]*block.Block, 0, len(chain))
+	newChain = append(newChain, bc.chain[:fork+1]...)
+	newChain = append(newChain, chain[fork+1:]...)
+	detached := bc.chain[fork+1:]
+
+	for height := len(bc.chain) - 1; height > fork; height-- {
+		if err := bc.state.undoBlock(bc.chain[height], height); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	height := fork + 1
+
+	for ; height < len(newChain); height++ {
+		b := newChain[height]
+
+		err = bc.validateBlock(bc.state, newChain[:height], b)
+		if err == nil {
+			err = bc.state.applyBlock(b, height)
+		}
+
+		if err != nil {
+			err = &ValidationError{Height: height, Err: err}
+			break
+		}
+	}
+
+	if err == nil {
+		err = bc.storeChain(newChain, fork)
+	}
+
+	if err != nil {
+		for height -= 1; height > fork; height-- {
+			if undoErr := bc.state.undoBlock(newChain[height], height); undoErr != nil {
+				log.Printf("ERROR: %v", undoErr)
+			}
+		}
+		for height := fork + 1; height < len(bc.chain); height++ {
+			if applyErr := bc.state.applyBlock(bc.chain[height], height); applyErr != nil {
+				log.Printf("ERROR: %v", applyErr)
+			}
+		}
+
+		return err
+	}
+
+	oldTip := bc.tip().Hash()
+	bc.chain = newChain
+
+	orphaned := make([]*transaction.Transaction, 0)
+	for _, b := range detached {
+		for _, t := range b.Transactions {
+			if !t.IsCoinbase() {
+				orphaned = append(orphaned, t)
+			}
+		}
+	}
+	reinjected := bc.resetTransactionPool(orphaned)
+
+	if len(detached) > 0 {
+		bc.recordReorg(&ReorgEvent{
+			Time:       time.Now(),
+			ForkHeight: fork,
+			Depth:      len(detached),
+			Attached:   len(newChain) - fork - 1,
+			OldTip:     oldTip,
+			NewTip:     bc.tip().Hash(),
+			Reinjected: reinjected,
+		})
+	}
+
+	return nil
+}
+
+// storeChain persists newChain, which shares the blocks up to fork with the
+// local chain. A plain extension of the tip is appended block by block
+// instead of rewriting the store.
+func (bc *Blockchain) storeChain(newChain []*block.Block, fork int) error {
+	if fork != len(bc.chain)-1 {
+		return bc.store.ReplaceChain(newChain)
+	}
+
+	for _, b := range newChain[fork+1:] {
+		if err := bc.store.AppendBlock(b); err != nil {
+			// Drop the blocks of the extension appended so far.
+			if restoreErr := bc.store.ReplaceChain(bc.chain); restoreErr != nil {
+				log.Printf("ERROR: %v", restoreErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (bc *Blockchain) recordReorg(e *ReorgEvent) {
+	log.Printf(
+		"action=reorg, fork_height=%d, depth=%d, attached=%d, reinjected=%d",
+		e.ForkHeight,
+		e.Depth,
+		e.Attached,
+		e.Reinjected,
+	)
+
+	bc.reorgs = append(bc.reorgs, e)
+	if len(bc.reorgs) > MAX_REORG_EVENTS {
+		bc.reorgs = bc.reorgs[len(bc.reorgs)-MAX_REORG_EVENTS:]
+	}
+}
+
+// resetTransactionPool readmits the orphaned transactions, followed by the
+// pooled ones, against the current state. Whatever the new chain already
+// confirms or conflicts with is dropped. It returns how many orphaned
+// transactions made it back into the pool.
+func (bc *Blockchain) resetTransactionPool(orphaned []*transaction.Transaction) int {
+	pooled := bc.TransactionPool()
+	bc.transactionPool.Clear()
+
+	reinjected := 0
+	for i, t := range append(orphaned, pooled...) {
+		if _, ok := bc.state.transactionHeight(t.Hash()); ok {
+			continue
+		}
+
+		if err := bc.checkTransaction(t); err != nil {
+			continue
+		}
+
+		if err := bc.transactionPool.Add(t); err != nil {
+			continue
+		}
+
+		if i < len(orphaned) {
+			reinjected += 1
+		}
+	}
+
+	bc.saveTransactionPool()
+
+	return reinjected
+}
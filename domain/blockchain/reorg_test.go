@@ -0,0 +1,307 @@
+package blockchain
+
+import (
+	"errors"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/store"
+	"goblockchain/domain/transaction"
+	"goblockchain/domain/wallet"
+	"testing"
+)
+
+var errStoreFailed = errors.New("store failed")
+
+// failingStore fails every write of blocks once fail is set.
+type failingStore struct {
+	*store.MemoryStore
+	fail bool
+}
+
+func (s *failingStore) AppendBlock(b *block.Block) error {
+	if s.fail {
+		return errStoreFailed
+	}
+
+	return s.MemoryStore.AppendBlock(b)
+}
+
+func (s *failingStore) ReplaceChain(chain []*block.Block) error {
+	if s.fail {
+		return errStoreFailed
+	}
+
+	return s.MemoryStore.ReplaceChain(chain)
+}
+
+func hashes(chain []*block.Block) [][32]byte {
+	hashes := make([][32]byte, len(chain))
+	for i, b := range chain {
+		hashes[i] = b.Hash()
+	}
+
+	return hashes
+}
+
+func sameChain(a, b []*block.Block) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Hash() != b[i].Hash() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reorgFixture is a local chain whose block 1 confirms tx, a transaction of
+// w, and a second chain from the same genesis block to build branches on.
+type reorgFixture struct {
+	local *Blockchain
+	store *failingStore
+	other *Blockchain
+	w     *wallet.Wallet
+	tx    *transaction.Transaction
+}
+
+func newReorgFixture(t *testing.T) *reorgFixture {
+	w := wallet.NewWallet()
+	spec := testSpec(transaction.NewOutput(w.BlockchainAddress(), amount.COIN))
+
+	s := &failingStore{MemoryStore: store.NewMemoryStore()}
+	local, err := NewBlockchain("local", 0, s, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := spend(t, w, 0, local.UnspentOutputs(w.BlockchainAddress()), "recipient", amount.COIN/2, 1000)
+	if err := local.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, local, 1)
+
+	return &reorgFixture{
+		local: local,
+		store: s,
+		other: newTestBlockchain(t, "other", spec),
+		w:     w,
+		tx:    tx,
+	}
+}
+
+func TestReorganize(t *testing.T) {
+	tests := []struct {
+		name          string
+		branch        func(t *testing.T, f *reorgFixture) []*block.Block
+		wantReorg     bool
+		wantReinjects int
+		wantPooled    bool
+		wantConfirmed bool
+	}{
+		{
+			"orphaned transaction is reinjected",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				mineBlocks(t, f.other, 2)
+				return f.other.Chain()
+			},
+			true, 1, true, false,
+		},
+		{
+			"transaction confirmed by the branch is not reinjected",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				if err := f.other.AddTransaction(f.tx); err != nil {
+					t.Fatal(err)
+				}
+				mineBlocks(t, f.other, 2)
+				return f.other.Chain()
+			},
+			true, 0, false, true,
+		},
+		{
+			"transaction conflicting with the branch is dropped",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				unspent := f.other.UnspentOutputs(f.w.BlockchainAddress())
+				conflict := spend(t, f.w, 0, unspent, "other recipient", amount.COIN/4, 1000)
+				if err := f.other.AddTransaction(conflict); err != nil {
+					t.Fatal(err)
+				}
+				mineBlocks(t, f.other, 2)
+				return f.other.Chain()
+			},
+			true, 0, false, false,
+		},
+		{
+			"extension of the tip",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				chain := f.local.Chain()
+				b := nextBlock(f.local, coinbase(f.local, f.local.BlockReward(2), 2))
+				return append(chain[:len(chain):len(chain)], b)
+			},
+			false, 0, false, true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReorgFixture(t)
+			branch := tt.branch(t, f)
+
+			if err := f.local.reorganize(branch); err != nil {
+				t.Fatalf("reorganize = %v", err)
+			}
+
+			if !sameChain(f.local.chain, branch) {
+				t.Errorf("chain = %x, want %x", hashes(f.local.chain), hashes(branch))
+			}
+
+			if stored, _ := f.store.LoadChain(); !sameChain(stored, branch) {
+				t.Errorf("stored chain = %x, want %x", hashes(stored), hashes(branch))
+			}
+
+			if f.local.state.work.Cmp(chainWork(branch)) != 0 {
+				t.Errorf("work = %v, want %v", f.local.state.work, chainWork(branch))
+			}
+
+			if _, ok := f.local.transactionPool.Get(f.tx.Hash()); ok != tt.wantPooled {
+				t.Errorf("transaction pooled = %v, want %v", ok, tt.wantPooled)
+			}
+
+			if _, ok := f.local.state.transactionHeight(f.tx.Hash()); ok != tt.wantConfirmed {
+				t.Errorf("transaction confirmed = %v, want %v", ok, tt.wantConfirmed)
+			}
+
+			reorgs := f.local.Reorgs()
+			if !tt.wantReorg {
+				if len(reorgs) != 0 {
+					t.Errorf("%d reorgs recorded, want none", len(reorgs))
+				}
+				return
+			}
+
+			if len(reorgs) != 1 {
+				t.Fatalf("%d reorgs recorded, want 1", len(reorgs))
+			}
+
+			e := reorgs[0]
+			if e.ForkHeight != 0 || e.Depth != 1 || e.Attached != len(branch)-1 || e.Reinjected != tt.wantReinjects {
+				t.Errorf(
+					"reorg fork=%d depth=%d attached=%d reinjected=%d, want fork=0 depth=1 attached=%d reinjected=%d",
+					e.ForkHeight, e.Depth, e.Attached, e.Reinjected, len(branch)-1, tt.wantReinjects,
+				)
+			}
+		})
+	}
+}
+
+func TestReorganizeRollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		branch     func(t *testing.T, f *reorgFixture) []*block.Block
+		failStore  bool
+		wantErr    error
+		wantHeight int
+	}{
+		{
+			"invalid first block",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				b := nextBlock(f.other, coinbase(f.other, MINING_REWARD+1, 1))
+				return append(f.other.Chain(), b)
+			},
+			false, ErrCoinbaseReward, 1,
+		},
+		{
+			"invalid last block",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				mineBlocks(t, f.other, 3)
+				b := nextBlock(f.other, coinbase(f.other, MINING_REWARD+1, 4))
+				return append(f.other.Chain(), b)
+			},
+			false, ErrCoinbaseReward, 4,
+		},
+		{
+			"unlinked block",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				mineBlocks(t, f.other, 2)
+				b := nextBlock(f.other, coinbase(f.other, MINING_REWARD, 3))
+				b.PreviousHash = [32]byte{1}
+				return append(f.other.Chain(), b)
+			},
+			false, ErrPreviousHash, 3,
+		},
+		{
+			"store failure",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				mineBlocks(t, f.other, 2)
+				return f.other.Chain()
+			},
+			true, errStoreFailed, -1,
+		},
+		{
+			"store failure on an extension of the tip",
+			func(t *testing.T, f *reorgFixture) []*block.Block {
+				chain := f.local.Chain()
+				b := nextBlock(f.local, coinbase(f.local, f.local.BlockReward(2), 2))
+				return append(chain[:len(chain):len(chain)], b)
+			},
+			true, errStoreFailed, -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReorgFixture(t)
+			branch := tt.branch(t, f)
+
+			chain := f.local.Chain()
+			work := chainWork(chain)
+			balance := f.local.state.accounts.Balance("recipient")
+
+			f.store.fail = tt.failStore
+			err := f.local.reorganize(branch)
+			f.store.fail = false
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reorganize = %v, want %v", err, tt.wantErr)
+			}
+
+			var ve *ValidationError
+			if errors.As(err, &ve) != (tt.wantHeight >= 0) || (ve != nil && ve.Height != tt.wantHeight) {
+				t.Errorf("reorganize = %v, want a validation error at height %d", err, tt.wantHeight)
+			}
+
+			if !sameChain(f.local.chain, chain) {
+				t.Errorf("chain = %x, want %x", hashes(f.local.chain), hashes(chain))
+			}
+
+			if stored, _ := f.store.LoadChain(); !sameChain(stored, chain) {
+				t.Errorf("stored chain = %x, want %x", hashes(stored), hashes(chain))
+			}
+
+			if f.local.state.work.Cmp(work) != 0 || len(f.local.state.spent) != len(chain) {
+				t.Errorf("state work %v at %d blocks, want %v at %d", f.local.state.work, len(f.local.state.spent), work, len(chain))
+			}
+
+			if height, ok := f.local.state.transactionHeight(f.tx.Hash()); !ok || height != 1 {
+				t.Errorf("transaction confirmed at %d, %v, want block 1", height, ok)
+			}
+
+			if got := f.local.state.accounts.Balance("recipient"); got != balance {
+				t.Errorf("recipient balance = %s, want %s", got, balance)
+			}
+
+			if n := f.local.transactionPool.Len(); n != 0 {
+				t.Errorf("%d pooled transactions, want none", n)
+			}
+
+			if n := len(f.local.Reorgs()); n != 0 {
+				t.Errorf("%d reorgs recorded, want none", n)
+			}
+
+			// The restored chain still accepts the next block.
+			mineBlocks(t, f.local, 1)
+		})
+	}
+}
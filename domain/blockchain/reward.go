@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"goblockchain/domain/amount"
+)
+
+const (
+	HALVING_INTERVAL = 1000
+	MAX_SUPPLY       = 2000 * amount.COIN
+)
+
+// subsidy is the reward of the block at height before the supply cap: it
+// starts at MINING_REWARD at height 1 and halves every HALVING_INTERVAL
+// blocks.
+func subsidy(height int) amount.Amount {
+	if height <= 0 {
+		return 0
+	}
+
+	halvings := (height - 1) / HALVING_INTERVAL
+	if halvings >= 63 {
+		return 0
+	}
+
+	return MINING_REWARD >> uint(halvings)
+}
+
+// scheduledSupply is the sum of the subsidies of the blocks up to and
+// including height.
+func scheduledSupply(height int) amount.Amount {
+	var total amount.Amount = 0
+
+	for start := 1; start <= height; start += HALVING_INTERVAL {
+		reward := subsidy(start)
+		if reward == 0 {
+			break
+		}
+
+		end := start + HALVING_INTERVAL - 1
+		if end > height {
+			end = height
+		}
+		total += reward * amount.Amount(end-start+1)
+	}
+
+	return total
+}
+
+// premine is what the genesis coinbase allocates. It counts against
+// MAX_SUPPLY.
+func (bc *Blockchain) premine() amount.Amount {
+	var total amount.Amount = 0
+	for _, t := range bc.genesis.Transactions {
+		total += t.OutputValue()
+	}
+
+	return total
+}
+
+// BlockReward returns what the coinbase of the block at height may pay on
+// top of the fees: the halving subsidy, cut down so that the premine and all
+// rewards together never exceed MAX_SUPPLY.
+func (bc *Blockchain) BlockReward(height int) amount.Amount {
+	remaining := MAX_SUPPLY - bc.premine() - scheduledSupply(height-1)
+	if remaining <= 0 {
+		return 0
+	}
+
+	reward := subsidy(height)
+	if reward > remaining {
+		return remaining
+	}
+
+	return reward
+}
+
+// Supply returns the height of the tip and the coins issued up to it: the
+// premine plus every block reward. Fees only move coins and are not counted.
+func (bc *Blockchain) Supply() (int, amount.Amount) {
+	bc.Lock()
+	height := len(bc.chain) - 1
+	bc.Unlock()
+
+	premine := bc.premine()
+
+	issued := scheduledSupply(height)
+	if issued > MAX_SUPPLY-premine {
+		issued = MAX_SUPPLY - premine
+	}
+
+	return height, premine + issued
+}
@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"fmt"
+	"goblockchain/domain/account"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"goblockchain/domain/utxo"
+	"math/big"
+)
+
+// chainState holds everything derived from replaying the blocks of a chain.
+// It is updated block by block on CreateBlock, and rolled back and forward by
+// a reorg. spent keeps the entries each block spent, so that the block can be
+// undone.
+type chainState struct {
+	utxos        *utxo.Set
+	accounts     *account.Index
+	transactions map[[32]byte]int
+	blocks       map[[32]byte]int
+	work         *big.Int
+	spent        [][]*utxo.Entry
+}
+
+func newChainState() *chainState {
+	return &chainState{
+		utxos:        utxo.NewSet(),
+		accounts:     account.NewIndex(),
+		transactions: make(map[[32]byte]int),
+		blocks:       make(map[[32]byte]int),
+		work:         big.NewInt(0),
+	}
+}
+
+// checkBlock reports whether the block can be applied on top of the state.
+func (cs *chainState) checkBlock(b *block.Block) error {
+	if err := cs.utxos.CheckBlock(b); err != nil {
+		return err
+	}
+
+	return cs.accounts.CheckBlock(b)
+}
+
+// transactionHeight returns the height of the block that includes the
+// transaction with the given hash.
+func (cs *chainState) transactionHeight(hash [32]byte) (int, bool) {
+	height, ok := cs.transactions[hash]
+	return height, ok
+}
+
+// blockHeight returns the height of the block with the given hash, if it is
+// part of the chain.
+func (cs *chainState) blockHeight(hash [32]byte) (int, bool) {
+	height, ok := cs.blocks[hash]
+	return height, ok
+}
+
+func (cs *chainState) applyBlock(b *block.Block, height int) error {
+	if err := cs.accounts.CheckBlock(b); err != nil {
+		return err
+	}
+
+	if height != len(cs.spent) {
+		return fmt.Errorf("state: block %d does not follow height %d", height, len(cs.spent)-1)
+	}
+
+	spent, err := cs.utxos.ApplyBlock(b, height)
+	if err != nil {
+		return err
+	}
+
+	cs.accounts.ApplyBlock(b, spent)
+
+	for _, t := range b.Transactions {
+		cs.transactions[t.Hash()] = height
+	}
+
+	cs.blocks[b.Hash()] = height
+	cs.work.Add(cs.work, pow.CalcWork(b.Bits))
+	cs.spent = append(cs.spent, spent)
+
+	return nil
+}
+
+// undoBlock reverts applyBlock for the block at the tip of the state.
+func (cs *chainState) undoBlock(b *block.Block, height int) error {
+	if height != len(cs.spent)-1 {
+		return fmt.Errorf("state: block %d is not the tip %d", height, len(cs.spent)-1)
+	}
+
+	spent := cs.spent[height]
+
+	cs.utxos.UndoBlock(b, spent)
+	cs.accounts.UndoBlock(b, spent)
+
+	for _, t := range b.Transactions {
+		delete(cs.transactions, t.Hash())
+	}
+
+	delete(cs.blocks, b.Hash())
+	cs.work.Sub(cs.work, pow.CalcWork(b.Bits))
+	cs.spent = cs.spent[:height]
+
+	return nil
+}
+
+// rebuildState replays an already validated chain, e.g. the one loaded from
+// the store at startup.
+func rebuildState(chain []*block.Block) (*chainState, error) {
+	cs := newChainState()
+
+	for height, b := range chain {
+		if err := cs.applyBlock(b, height); err != nil {
+			return nil, fmt.Errorf("block %d: %w", height, err)
+		}
+	}
+
+	return cs, nil
+}
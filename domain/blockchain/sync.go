@@ -0,0 +1,282 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	// MAX_BLOCKS_PER_REQUEST bounds the blocks or headers served, and
+	// fetched, per range request.
+	MAX_BLOCKS_PER_REQUEST = 100
+	// MAX_HEADERS_PER_SYNC bounds the headers pulled from a neighbor in one
+	// sync. A longer chain is caught up with over several syncs.
+	MAX_HEADERS_PER_SYNC = 2000
+)
+
+var ErrInvalidHeaders = errors.New("neighbor sent an invalid header chain")
+
+// BlockRange returns up to limit blocks of the chain starting at height from.
+func (bc *Blockchain) BlockRange(from int, limit int) []*block.Block {
+	if limit > MAX_BLOCKS_PER_REQUEST {
+		limit = MAX_BLOCKS_PER_REQUEST
+	}
+
+	chain := bc.Chain()
+	if from < 0 || from >= len(chain) || limit <= 0 {
+		return []*block.Block{}
+	}
+
+	to := from + limit
+	if to > len(chain) {
+		to = len(chain)
+	}
+
+	return chain[from:to]
+}
+
+// syncFrom syncs headers first with the neighbor at host: it finds the fork
+// point, downloads the headers after it and checks their links and proofs of
+// work, and only if they add up to more work than the local chain downloads
+// the blocks and reorganizes onto them. It reports whether the chain changed.
+// The neighbor is queried against a snapshot of the chain without holding the
+// lock, which is only taken to compare against and switch the current chain.
+func (bc *Blockchain) syncFrom(host string) (bool, error) {
+	tip, err := fetchTip(host)
+	if err != nil {
+		return false, err
+	}
+
+	bc.Lock()
+	_, known := bc.state.blockHeight(tip.Hash())
+	chain := bc.chain
+	localWork := new(big.Int).Set(bc.state.work)
+	bc.Unlock()
+
+	if known {
+		return false, nil
+	}
+
+	fork, err := findForkPoint(host, chain, tip.Height)
+	if err != nil {
+		return false, err
+	}
+
+	headers, err := fetchHeaderChain(host, chain[fork], tip)
+	if err != nil {
+		return false, err
+	}
+
+	work := chainWork(chain[:fork+1])
+	work.Add(work, chainWork(headers))
+
+	last := headers[len(headers)-1].Hash()
+	if !isBetterChain(work, last, localWork, chain[len(chain)-1].Hash()) {
+		return false, nil
+	}
+
+	candidate := make([]*block.Block, 0, fork+1+len(headers))
+	candidate = append(candidate, chain[:fork+1]...)
+
+	for len(candidate) < fork+1+len(headers) {
+		blocks, err := fetchRange(host, "blocks", len(candidate), MAX_BLOCKS_PER_REQUEST)
+		if err != nil {
+			return false, err
+		}
+
+		if len(blocks) == 0 {
+			return false, fmt.Errorf("%s: missing blocks from height %d", host, len(candidate))
+		}
+
+		for _, b := range blocks {
+			i := len(candidate) - fork - 1
+			if i >= len(headers) {
+				break
+			}
+
+			if b.Hash() != headers[i].Hash() {
+				return false, fmt.Errorf("%s: block %d does not match its header", host, b.Height)
+			}
+			candidate = append(candidate, b)
+		}
+	}
+
+	bc.Lock()
+	defer bc.Unlock()
+
+	// The chain may have moved on while the neighbor was queried.
+	if !isBetterChain(work, last, bc.state.work, bc.tip().Hash()) {
+		return false, nil
+	}
+
+	if err := bc.reorganize(candidate); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// findForkPoint returns the height of the last block chain shares with the
+// neighbor. It steps back from the lower of both tips in growing steps until
+// the hashes match, and then scans forward from there.
+func findForkPoint(host string, chain []*block.Block, peerHeight int) (int, error) {
+	height := len(chain) - 1
+	if peerHeight < height {
+		height = peerHeight
+	}
+
+	step := 1
+	for height > 0 {
+		headers, err := fetchRange(host, "headers", height, 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(headers) == 1 && headers[0].Hash() == chain[height].Hash() {
+			break
+		}
+
+		height -= step
+		if height < 0 {
+			height = 0
+		}
+		step *= 2
+	}
+
+	if height == 0 {
+		headers, err := fetchRange(host, "headers", 0, 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(headers) != 1 || headers[0].Hash() != chain[0].Hash() {
+			return 0, &ValidationError{Height: 0, Err: ErrGenesisMismatch}
+		}
+	}
+
+	// The scan only goes as far as the last mismatch seen above.
+	limit := height + step
+	if limit > len(chain)-1 {
+		limit = len(chain) - 1
+	}
+	if limit > peerHeight {
+		limit = peerHeight
+	}
+
+	for height < limit {
+		headers, err := fetchRange(host, "headers", height+1, MAX_BLOCKS_PER_REQUEST)
+		if err != nil {
+			return 0, err
+		}
+
+		if len(headers) == 0 {
+			break
+		}
+
+		for _, h := range headers {
+			if h.Height > limit || h.Hash() != chain[h.Height].Hash() {
+				return height, nil
+			}
+			height = h.Height
+		}
+	}
+
+	return height, nil
+}
+
+// fetchHeaderChain downloads the headers after base up to the neighbor's
+// tip, at most MAX_HEADERS_PER_SYNC of them, and checks that they link up,
+// carry their heights and satisfy their own bits, and that they end at the
+// tip the neighbor claimed unless the cap cut them short. The bits themselves
+// are only checked against the retarget rule when the blocks are validated.
+func fetchHeaderChain(host string, base *block.Block, tip *block.Block) ([]*block.Block, error) {
+	headers := make([]*block.Block, 0)
+	prev := base
+
+	for prev.Height < tip.Height && len(headers) < MAX_HEADERS_PER_SYNC {
+		batch, err := fetchRange(host, "headers", prev.Height+1, MAX_BLOCKS_PER_REQUEST)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, h := range batch {
+			if h.Height != prev.Height+1 ||
+				h.PreviousHash != prev.Hash() ||
+				!pow.CheckProofOfWork(h.Hash(), h.Bits) {
+				return nil, ErrInvalidHeaders
+			}
+
+			if len(headers) == MAX_HEADERS_PER_SYNC {
+				break
+			}
+			headers = append(headers, h)
+			prev = h
+		}
+	}
+
+	if len(headers) == 0 {
+		return nil, ErrInvalidHeaders
+	}
+
+	if len(headers) < MAX_HEADERS_PER_SYNC && prev.Hash() != tip.Hash() {
+		return nil, ErrInvalidHeaders
+	}
+
+	return headers, nil
+}
+
+func fetchTip(host string) (*block.Block, error) {
+	b := new(block.Block)
+	if err := getJSON(fmt.Sprintf("http://%s/blocks/latest", host), b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// fetchRange gets up to limit blocks, or headers when kind is "headers",
+// from height from on.
+func fetchRange(host string, kind string, from int, limit int) ([]*block.Block, error) {
+	var resp struct {
+		Blocks []*block.Block `json:"blocks"`
+	}
+
+	endpoint := fmt.Sprintf("http://%s/%s?from=%d&limit=%d", host, kind, from, limit)
+	if err := getJSON(endpoint, &resp); err != nil {
+		return nil, err
+	}
+
+	for i, b := range resp.Blocks {
+		if b.Height != from+i {
+			return nil, fmt.Errorf("%s: unexpected height %d in range from %d", host, b.Height, from)
+		}
+	}
+
+	return resp.Blocks, nil
+}
+
+func getJSON(endpoint string, v interface{}) error {
+	client := &http.Client{Timeout: BLOCK_FETCH_TIMEOUT_SEC * time.Second}
+
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,297 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/utxo"
+	"sort"
+	"time"
+)
+
+const (
+	// MAX_FUTURE_BLOCK_TIME_SEC is how far ahead of the local clock a block
+	// timestamp may be.
+	MAX_FUTURE_BLOCK_TIME_SEC = 2 * 60 * 60
+	// MEDIAN_TIME_SPAN is how many previous blocks the median time past is
+	// taken over.
+	MEDIAN_TIME_SPAN = 11
+	// MAX_BLOCK_SIZE bounds the serialized size of a block in bytes and
+	// MAX_BLOCK_TRANSACTIONS its transactions, coinbase included.
+	MAX_BLOCK_SIZE         = 1 << 20
+	MAX_BLOCK_TRANSACTIONS = 1000
+)
+
+var (
+	ErrEmptyChain          = errors.New("empty chain")
+	ErrGenesisMismatch     = errors.New("genesis block does not match")
+	ErrUnexpectedHeight    = errors.New("unexpected height")
+	ErrPreviousHash        = errors.New("previous hash mismatch")
+	ErrMalformedBlock      = errors.New("block has a missing transaction, input or output")
+	ErrBlockTooLarge       = errors.New("block exceeds the maximum size")
+	ErrTooManyTransactions = errors.New("block exceeds the maximum number of transactions")
+	ErrMerkleRoot          = errors.New("merkle root mismatch")
+	ErrUnexpectedBits      = errors.New("unexpected bits")
+	ErrProofOfWork         = errors.New("invalid proof of work")
+	ErrTimestampTooOld     = errors.New("timestamp is not after the median time past")
+	ErrTimestampTooNew     = errors.New("timestamp is too far in the future")
+	ErrMissingCoinbase     = errors.New("first transaction is not a coinbase")
+	ErrExtraCoinbase       = errors.New("more than one coinbase")
+	ErrInvalidCoinbase     = errors.New("malformed coinbase")
+	ErrCoinbaseReward      = errors.New("coinbase does not pay the reward plus fees")
+	ErrFeesExceedMaxValue  = errors.New("fees exceed the maximum amount")
+)
+
+// ValidationError tells which block of a chain is invalid and why. Err is
+// one of the errors above, a transaction error such as ErrInvalidSignature,
+// or an error of the UTXO set or the account index.
+type ValidationError struct {
+	Height int
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("block %d: %v", e.Height, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateChain checks every block of the chain from the genesis block on and
+// returns a *ValidationError for the first invalid one.
+func (bc *Blockchain) ValidateChain(chain []*block.Block) error {
+	_, err := bc.replayChain(chain)
+	return err
+}
+
+// replayChain validates the chain and returns the state it results in.
+func (bc *Blockchain) replayChain(chain []*block.Block) (*chainState, error) {
+	if len(chain) == 0 {
+		return nil, &ValidationError{Height: 0, Err: ErrEmptyChain}
+	}
+
+	if err := bc.checkGenesis(chain[0]); err != nil {
+		return nil, &ValidationError{Height: 0, Err: err}
+	}
+
+	state := newChainState()
+	if err := state.applyBlock(chain[0], 0); err != nil {
+		return nil, &ValidationError{Height: 0, Err: err}
+	}
+
+	for height := 1; height < len(chain); height++ {
+		b := chain[height]
+
+		if err := bc.validateBlock(state, chain[:height], b); err != nil {
+			return nil, &ValidationError{Height: height, Err: err}
+		}
+
+		if err := state.applyBlock(b, height); err != nil {
+			return nil, &ValidationError{Height: height, Err: err}
+		}
+	}
+
+	return state, nil
+}
+
+// checkGenesis reports whether b is the genesis block of the network,
+// including its transactions.
+func (bc *Blockchain) checkGenesis(b *block.Block) error {
+	if err := checkStructure(b); err != nil {
+		return err
+	}
+
+	if b.Hash() != bc.genesis.Hash() || b.MerkleRoot != block.MerkleRoot(b.Transactions) {
+		return ErrGenesisMismatch
+	}
+
+	return nil
+}
+
+// checkStructure rejects blocks with missing transactions, inputs or
+// outputs, before any other check dereferences them.
+func checkStructure(b *block.Block) error {
+	for _, t := range b.Transactions {
+		if !wellFormed(t) {
+			return ErrMalformedBlock
+		}
+	}
+
+	return nil
+}
+
+// validateBlock checks that b can follow chain, whose state is state. It
+// does not modify the state.
+func (bc *Blockchain) validateBlock(state *chainState, chain []*block.Block, b *block.Block) error {
+	if err := checkStructure(b); err != nil {
+		return err
+	}
+
+	prev := chain[len(chain)-1]
+
+	if b.Height != len(chain) {
+		return fmt.Errorf("%w %d", ErrUnexpectedHeight, b.Height)
+	}
+
+	if b.PreviousHash != prev.Hash() {
+		return ErrPreviousHash
+	}
+
+	if len(b.Transactions) > MAX_BLOCK_TRANSACTIONS {
+		return ErrTooManyTransactions
+	}
+
+	if b.Size() > MAX_BLOCK_SIZE {
+		return ErrBlockTooLarge
+	}
+
+	if b.MerkleRoot != block.MerkleRoot(b.Transactions) {
+		return ErrMerkleRoot
+	}
+
+	if b.Bits != bc.NextBits(chain) {
+		return fmt.Errorf("%w %08x", ErrUnexpectedBits, b.Bits)
+	}
+
+	if !bc.ValidProof(b) {
+		return ErrProofOfWork
+	}
+
+	if b.Timestamp <= medianTimePast(chain) {
+		return ErrTimestampTooOld
+	}
+
+	if b.Timestamp > time.Now().Add(MAX_FUTURE_BLOCK_TIME_SEC*time.Second).UnixNano() {
+		return ErrTimestampTooNew
+	}
+
+	fees, err := bc.checkBlockTransactions(state, b)
+	if err != nil {
+		return err
+	}
+
+	if err := checkCoinbase(b, bc.BlockReward(b.Height)+fees); err != nil {
+		return err
+	}
+
+	return state.checkBlock(b)
+}
+
+// medianTimePast is the median timestamp of the last MEDIAN_TIME_SPAN blocks
+// of the chain, or of all of them if it is shorter. Unlike the timestamp of
+// the last block alone, a single miner cannot move it.
+func medianTimePast(chain []*block.Block) int64 {
+	n := MEDIAN_TIME_SPAN
+	if len(chain) < n {
+		n = len(chain)
+	}
+
+	timestamps := make([]int64, 0, n)
+	for _, b := range chain[len(chain)-n:] {
+		timestamps = append(timestamps, b.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	return timestamps[n/2]
+}
+
+// checkBlockTransactions verifies the signatures and values of every
+// transaction but the coinbase and returns the sum of their fees.
+func (bc *Blockchain) checkBlockTransactions(state *chainState, b *block.Block) (amount.Amount, error) {
+	var fees amount.Amount = 0
+
+	for i, t := range b.Transactions {
+		if i == 0 {
+			continue
+		}
+
+		if t.IsCoinbase() || t.SenderBlockchainAddress == MINING_SENDER {
+			return 0, ErrExtraCoinbase
+		}
+
+		if err := bc.verifyTransaction(t); err != nil {
+			return 0, fmt.Errorf("transaction %s: %w", t.ID(), err)
+		}
+
+		if len(t.Inputs) == 0 || len(t.Outputs) == 0 {
+			return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrEmptyTransaction)
+		}
+
+		var outputValue amount.Amount = 0
+		for _, o := range t.Outputs {
+			outputValue += o.Value
+			if o.Value <= 0 || !o.Value.Valid() || !outputValue.Valid() {
+				return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrInvalidValue)
+			}
+		}
+
+		if !t.Fee.Valid() {
+			return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrInvalidFee)
+		}
+
+		var inputValue amount.Amount = 0
+		for _, in := range t.Inputs {
+			e, ok := state.utxos.Get(utxo.Outpoint{Hash: in.PreviousHash, Index: in.Index})
+			if !ok {
+				return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrUnknownInput)
+			}
+
+			if e.Output.BlockchainAddress != t.SenderBlockchainAddress {
+				return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrInputNotOwned)
+			}
+
+			if !mature(e, b.Height) {
+				return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrImmatureCoinbase)
+			}
+
+			inputValue += e.Output.Value
+		}
+
+		if outputValue+t.Fee > inputValue {
+			return 0, fmt.Errorf("transaction %s: %w", t.ID(), ErrInputsTooLow)
+		}
+
+		fees += t.Fee
+		if !fees.Valid() {
+			return 0, ErrFeesExceedMaxValue
+		}
+	}
+
+	return fees, nil
+}
+
+// checkCoinbase checks that the first transaction of the block, and only
+// that one, is a coinbase for the block height paying exactly value, the
+// block reward plus the fees of the block.
+func checkCoinbase(b *block.Block, value amount.Amount) error {
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return ErrMissingCoinbase
+	}
+
+	coinbase := b.Transactions[0]
+	if coinbase.SenderBlockchainAddress != MINING_SENDER ||
+		coinbase.Inputs[0].Index != b.Height ||
+		coinbase.Nonce != 0 ||
+		coinbase.Fee != 0 ||
+		len(coinbase.Outputs) == 0 {
+		return ErrInvalidCoinbase
+	}
+
+	var reward amount.Amount = 0
+	for _, o := range coinbase.Outputs {
+		reward += o.Value
+		if o.Value <= 0 || !o.Value.Valid() || !reward.Valid() {
+			return ErrInvalidCoinbase
+		}
+	}
+
+	if reward != value {
+		return ErrCoinbaseReward
+	}
+
+	return nil
+}
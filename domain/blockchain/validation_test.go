@@ -0,0 +1,281 @@
+package blockchain
+
+import (
+	"errors"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"goblockchain/domain/store"
+	"goblockchain/domain/transaction"
+	"goblockchain/domain/utxo"
+	"goblockchain/domain/wallet"
+	"testing"
+)
+
+// testSpec is a genesis spec at the proof-of-work limit, so that test blocks
+// take only a few hundred hashes to mine.
+func testSpec(allocations ...*transaction.Output) *GenesisSpec {
+	return &GenesisSpec{
+		Timestamp:   GENESIS_TIMESTAMP,
+		Bits:        pow.POW_LIMIT_BITS,
+		Allocations: allocations,
+	}
+}
+
+func newTestBlockchain(t *testing.T, miner string, spec *GenesisSpec) *Blockchain {
+	bc, err := NewBlockchain(miner, 0, store.NewMemoryStore(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bc
+}
+
+// mineBlocks mines n blocks from the pool on top of the tip.
+func mineBlocks(t *testing.T, bc *Blockchain, n int) {
+	for i := 0; i < n; i++ {
+		if bc.mineBlock() == nil {
+			t.Fatalf("block %d was not connected", len(bc.chain))
+		}
+	}
+}
+
+// nextBlock mines a block with exactly the given transactions on top of the
+// tip, without connecting it.
+func nextBlock(bc *Blockchain, transactions ...*transaction.Transaction) *block.Block {
+	b := block.NewBlock(0, len(bc.chain), bc.tip().Hash(), bc.NextBits(bc.chain), transactions)
+	if mtp := medianTimePast(bc.chain); b.Timestamp <= mtp {
+		b.Timestamp = mtp + 1
+	}
+	bc.ProofOfWork(b)
+
+	return b
+}
+
+// coinbase pays value to the miner of bc in the block at height.
+func coinbase(bc *Blockchain, value amount.Amount, height int) *transaction.Transaction {
+	return transaction.NewCoinbaseTransaction(MINING_SENDER, bc.blockchainAddress, value, height)
+}
+
+// spend signs a transaction of w that spends the entries and pays value to
+// recipient, with the rest minus the fee going back to w.
+func spend(
+	t *testing.T,
+	w *wallet.Wallet,
+	nonce uint64,
+	entries []*utxo.Entry,
+	recipient string,
+	value amount.Amount,
+	fee amount.Amount,
+) *transaction.Transaction {
+	wt, err := wallet.NewTransaction(
+		w.PrivateKey(),
+		w.PublicKey(),
+		w.BlockchainAddress(),
+		recipient,
+		value,
+		fee,
+		nonce,
+		entries,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction.NewTransaction(
+		w.BlockchainAddress(),
+		w.PublicKeyStr(),
+		wt.Nonce(),
+		wt.Fee(),
+		wt.Inputs(),
+		wt.Outputs(),
+		wt.GenerateSignature().String(),
+	)
+}
+
+func TestBlockReward(t *testing.T) {
+	tests := []struct {
+		name    string
+		premine amount.Amount
+		height  int
+		want    amount.Amount
+	}{
+		{"genesis", 0, 0, 0},
+		{"first block", 0, 1, MINING_REWARD},
+		{"last block before the halving", 0, HALVING_INTERVAL, MINING_REWARD},
+		{"first halving", 0, HALVING_INTERVAL + 1, MINING_REWARD / 2},
+		{"second halving", 0, 2*HALVING_INTERVAL + 1, MINING_REWARD / 4},
+		{"subsidy exhausted", 0, 64*HALVING_INTERVAL + 1, 0},
+		{"premine below the cap", 1000 * amount.COIN, HALVING_INTERVAL, MINING_REWARD},
+		{"cap reached", 1000 * amount.COIN, HALVING_INTERVAL + 1, 0},
+		{"reward cut at the cap", 1000*amount.COIN + 3*amount.COIN/4, HALVING_INTERVAL, amount.COIN / 4},
+		{"premine at the cap", MAX_SUPPLY, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var allocations []*transaction.Output
+			if tt.premine > 0 {
+				allocations = append(allocations, transaction.NewOutput("premine", tt.premine))
+			}
+			bc := &Blockchain{genesis: testSpec(allocations...).Block()}
+
+			if got := bc.BlockReward(tt.height); got != tt.want {
+				t.Errorf("BlockReward(%d) = %s, want %s", tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCoinbase(t *testing.T) {
+	const FEE = 1000
+
+	w := wallet.NewWallet()
+
+	tests := []struct {
+		name         string
+		transactions func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction
+		want         error
+	}{
+		{
+			"reward",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD, 1)}
+			},
+			nil,
+		},
+		{
+			"reward plus fees",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD+FEE, 1), tx}
+			},
+			nil,
+		},
+		{
+			"fees left out",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD, 1), tx}
+			},
+			ErrCoinbaseReward,
+		},
+		{
+			"reward too high",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD+1, 1)}
+			},
+			ErrCoinbaseReward,
+		},
+		{
+			"no transactions",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{}
+			},
+			ErrMissingCoinbase,
+		},
+		{
+			"coinbase not first",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{tx, coinbase(bc, MINING_REWARD+FEE, 1)}
+			},
+			ErrExtraCoinbase,
+		},
+		{
+			"second coinbase",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD, 1), coinbase(bc, 1, 1)}
+			},
+			ErrExtraCoinbase,
+		},
+		{
+			"coinbase of another height",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, MINING_REWARD, 2)}
+			},
+			ErrInvalidCoinbase,
+		},
+		{
+			"coinbase paying nothing",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				return []*transaction.Transaction{coinbase(bc, 0, 1)}
+			},
+			ErrInvalidCoinbase,
+		},
+		{
+			"coinbase with a fee",
+			func(bc *Blockchain, tx *transaction.Transaction) []*transaction.Transaction {
+				cb := coinbase(bc, MINING_REWARD, 1)
+				cb.Fee = 1
+				return []*transaction.Transaction{cb}
+			},
+			ErrInvalidCoinbase,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newTestBlockchain(t, "miner", testSpec(transaction.NewOutput(w.BlockchainAddress(), amount.COIN)))
+			tx := spend(t, w, 0, bc.UnspentOutputs(w.BlockchainAddress()), "recipient", amount.COIN/2, FEE)
+
+			b := nextBlock(bc, tt.transactions(bc, tx)...)
+
+			if err := bc.validateBlock(bc.state, bc.chain, b); !errors.Is(err, tt.want) {
+				t.Errorf("validateBlock = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	tests := []struct {
+		name   string
+		height int
+		want   error
+	}{
+		{"next block", 2, ErrImmatureCoinbase},
+		{"one block short", COINBASE_MATURITY + 1, ErrImmatureCoinbase},
+		{"mature", COINBASE_MATURITY + 2, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := wallet.NewWallet()
+			bc := newTestBlockchain(t, w.BlockchainAddress(), testSpec())
+			mineBlocks(t, bc, tt.height-1)
+
+			// The coinbase of block 1.
+			var entries []*utxo.Entry
+			for _, e := range bc.state.utxos.FindByAddress(w.BlockchainAddress()) {
+				if e.Height == 1 {
+					entries = append(entries, e)
+				}
+			}
+
+			tx := spend(t, w, 0, entries, "recipient", MINING_REWARD, 0)
+
+			if err := bc.checkTransaction(tx); !errors.Is(err, tt.want) {
+				t.Errorf("checkTransaction = %v, want %v", err, tt.want)
+			}
+
+			b := nextBlock(bc, coinbase(bc, bc.BlockReward(tt.height), tt.height), tx)
+			if err := bc.validateBlock(bc.state, bc.chain, b); !errors.Is(err, tt.want) {
+				t.Errorf("validateBlock = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenesisAllocationsAreMature(t *testing.T) {
+	w := wallet.NewWallet()
+	bc := newTestBlockchain(t, "miner", testSpec(transaction.NewOutput(w.BlockchainAddress(), amount.COIN)))
+
+	tx := spend(t, w, 0, bc.UnspentOutputs(w.BlockchainAddress()), "recipient", amount.COIN, 0)
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatalf("AddTransaction = %v", err)
+	}
+
+	mineBlocks(t, bc, 1)
+
+	if height, ok := bc.state.transactionHeight(tx.Hash()); !ok || height != 1 {
+		t.Errorf("transaction confirmed at %d, %v, want block 1", height, ok)
+	}
+}
@@ -0,0 +1,31 @@
+package blockchain
+
+import (
+	"bytes"
+	"goblockchain/domain/block"
+	"goblockchain/domain/pow"
+	"math/big"
+)
+
+// chainWork sums the work of every block of the chain as claimed by its bits.
+// It does not validate the chain.
+func chainWork(chain []*block.Block) *big.Int {
+	work := big.NewInt(0)
+
+	for _, b := range chain {
+		work.Add(work, pow.CalcWork(b.Bits))
+	}
+
+	return work
+}
+
+// isBetterChain reports whether a chain with the given cumulative work and
+// tip should be preferred over the best one so far. More work wins; on equal
+// work the lower tip hash wins, so that every node makes the same choice.
+func isBetterChain(work *big.Int, tip [32]byte, bestWork *big.Int, bestTip [32]byte) bool {
+	if c := work.Cmp(bestWork); c != 0 {
+		return c > 0
+	}
+
+	return bytes.Compare(tip[:], bestTip[:]) < 0
+}
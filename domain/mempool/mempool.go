@@ -0,0 +1,190 @@
+package mempool
+
+import (
+	"errors"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicate = errors.New("mempool: transaction already in pool")
+	ErrPoolFull  = errors.New("mempool: pool is full and the fee rate is too low")
+)
+
+type entry struct {
+	transaction *transaction.Transaction
+	hash        [32]byte
+	feeRate     float64
+	added       time.Time
+	seq         uint64
+}
+
+// Pool holds the transactions waiting to be mined, keyed by transaction
+// hash. When it is full the entries with the lowest fee rate are evicted,
+// and entries older than the expiry are dropped on Expire.
+//
+// Removing a transaction for any reason other than its inclusion in a block
+// also removes the later nonces of the same sender, which could otherwise
+// never be mined.
+type Pool struct {
+	sync.Mutex
+	maxSize int
+	expiry  time.Duration
+	entries map[[32]byte]*entry
+	seq     uint64
+}
+
+func NewPool(maxSize int, expiry time.Duration) *Pool {
+	return &Pool{
+		maxSize: maxSize,
+		expiry:  expiry,
+		entries: make(map[[32]byte]*entry),
+	}
+}
+
+func (p *Pool) Add(t *transaction.Transaction) error {
+	p.Lock()
+	defer p.Unlock()
+
+	hash := t.Hash()
+	if _, ok := p.entries[hash]; ok {
+		return ErrDuplicate
+	}
+
+	e := &entry{
+		transaction: t,
+		hash:        hash,
+		feeRate:     t.FeeRate(),
+		added:       time.Now(),
+		seq:         p.seq,
+	}
+
+	for len(p.entries) >= p.maxSize {
+		lowest := p.lowest()
+		if lowest == nil || lowest.feeRate >= e.feeRate {
+			return ErrPoolFull
+		}
+
+		p.evict(lowest)
+	}
+
+	p.seq += 1
+	p.entries[hash] = e
+
+	return nil
+}
+
+func (p *Pool) lowest() *entry {
+	var lowest *entry
+
+	for _, e := range p.entries {
+		if lowest == nil ||
+			e.feeRate < lowest.feeRate ||
+			(e.feeRate == lowest.feeRate && e.seq > lowest.seq) {
+			lowest = e
+		}
+	}
+
+	return lowest
+}
+
+// evict removes the entry and every later nonce of its sender.
+func (p *Pool) evict(evicted *entry) {
+	sender := evicted.transaction.SenderBlockchainAddress
+
+	for hash, e := range p.entries {
+		t := e.transaction
+		if t.SenderBlockchainAddress == sender && t.Nonce >= evicted.transaction.Nonce {
+			delete(p.entries, hash)
+		}
+	}
+}
+
+func (p *Pool) Get(hash [32]byte) (*transaction.Transaction, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	e, ok := p.entries[hash]
+	if !ok {
+		return nil, false
+	}
+
+	return e.transaction, true
+}
+
+func (p *Pool) Len() int {
+	p.Lock()
+	defer p.Unlock()
+
+	return len(p.entries)
+}
+
+// Transactions returns the pooled transactions in the order they arrived.
+func (p *Pool) Transactions() []*transaction.Transaction {
+	p.Lock()
+	defer p.Unlock()
+
+	entries := make([]*entry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	transactions := make([]*transaction.Transaction, len(entries))
+	for i, e := range entries {
+		transactions[i] = e.transaction
+	}
+
+	return transactions
+}
+
+// RemoveBlock removes exactly the transactions included in the block.
+func (p *Pool) RemoveBlock(b *block.Block) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, t := range b.Transactions {
+		delete(p.entries, t.Hash())
+	}
+}
+
+// Retain keeps the transactions for which keep returns true, visiting them
+// in arrival order, and evicts the rest.
+func (p *Pool) Retain(keep func(t *transaction.Transaction) bool) {
+	for _, t := range p.Transactions() {
+		if keep(t) {
+			continue
+		}
+
+		p.Lock()
+		if e, ok := p.entries[t.Hash()]; ok {
+			p.evict(e)
+		}
+		p.Unlock()
+	}
+}
+
+// Expire evicts the entries that have been waiting longer than the expiry.
+func (p *Pool) Expire(now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, e := range p.entries {
+		if now.Sub(e.added) > p.expiry {
+			p.evict(e)
+		}
+	}
+}
+
+func (p *Pool) Clear() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.entries = make(map[[32]byte]*entry)
+}
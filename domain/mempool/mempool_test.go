@@ -0,0 +1,236 @@
+package mempool
+
+import (
+	"fmt"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/transaction"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testTransaction struct {
+	sender string
+	nonce  uint64
+	fee    amount.Amount
+}
+
+func (tt testTransaction) transaction() *transaction.Transaction {
+	return transaction.NewTransaction(tt.sender, "", tt.nonce, tt.fee, nil, nil, "")
+}
+
+func (tt testTransaction) name() string {
+	return fmt.Sprintf("%s/%d", tt.sender, tt.nonce)
+}
+
+func names(transactions []*transaction.Transaction) []string {
+	names := make([]string, len(transactions))
+	for i, t := range transactions {
+		names[i] = testTransaction{sender: t.SenderBlockchainAddress, nonce: t.Nonce}.name()
+	}
+
+	return names
+}
+
+func TestAddEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		pooled  []testTransaction
+		add     testTransaction
+		wantErr error
+		want    []string
+	}{
+		{
+			"room left",
+			3,
+			[]testTransaction{{"a", 0, 200}, {"b", 0, 300}},
+			testTransaction{"c", 0, 100},
+			nil,
+			[]string{"a/0", "b/0", "c/0"},
+		},
+		{
+			"lower fee rate is rejected",
+			2,
+			[]testTransaction{{"a", 0, 200}, {"b", 0, 300}},
+			testTransaction{"c", 0, 100},
+			ErrPoolFull,
+			[]string{"a/0", "b/0"},
+		},
+		{
+			"equal fee rate is rejected",
+			2,
+			[]testTransaction{{"a", 0, 200}, {"b", 0, 300}},
+			testTransaction{"c", 0, 200},
+			ErrPoolFull,
+			[]string{"a/0", "b/0"},
+		},
+		{
+			"higher fee rate evicts the lowest",
+			2,
+			[]testTransaction{{"a", 0, 200}, {"b", 0, 300}},
+			testTransaction{"c", 0, 400},
+			nil,
+			[]string{"b/0", "c/0"},
+		},
+		{
+			"tie evicts the latest arrival",
+			2,
+			[]testTransaction{{"a", 0, 200}, {"b", 0, 200}},
+			testTransaction{"c", 0, 300},
+			nil,
+			[]string{"a/0", "c/0"},
+		},
+		{
+			"eviction takes the later nonces of the sender",
+			3,
+			[]testTransaction{{"a", 0, 100}, {"b", 0, 200}, {"a", 1, 300}},
+			testTransaction{"c", 0, 150},
+			nil,
+			[]string{"b/0", "c/0"},
+		},
+		{
+			"eviction keeps the earlier nonces of the sender",
+			3,
+			[]testTransaction{{"a", 0, 300}, {"b", 0, 200}, {"a", 1, 100}},
+			testTransaction{"c", 0, 150},
+			nil,
+			[]string{"a/0", "b/0", "c/0"},
+		},
+		{
+			"duplicate",
+			3,
+			[]testTransaction{{"a", 0, 200}},
+			testTransaction{"a", 0, 200},
+			ErrDuplicate,
+			[]string{"a/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(tt.maxSize, time.Hour)
+			for _, pooled := range tt.pooled {
+				if err := p.Add(pooled.transaction()); err != nil {
+					t.Fatalf("Add(%s): %v", pooled.name(), err)
+				}
+			}
+
+			if err := p.Add(tt.add.transaction()); err != tt.wantErr {
+				t.Errorf("Add(%s) = %v, want %v", tt.add.name(), err, tt.wantErr)
+			}
+
+			if got := names(p.Transactions()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pool = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		pooled []testTransaction
+		ages   []time.Duration
+		want   []string
+	}{
+		{
+			"nothing expired",
+			[]testTransaction{{"a", 0, 100}, {"b", 0, 100}},
+			[]time.Duration{30 * time.Minute, 0},
+			[]string{"a/0", "b/0"},
+		},
+		{
+			"at the expiry is kept",
+			[]testTransaction{{"a", 0, 100}},
+			[]time.Duration{time.Hour},
+			[]string{"a/0"},
+		},
+		{
+			"expired entries are dropped",
+			[]testTransaction{{"a", 0, 100}, {"b", 0, 100}, {"c", 0, 100}},
+			[]time.Duration{2 * time.Hour, 0, time.Hour + time.Second},
+			[]string{"b/0"},
+		},
+		{
+			"expiry takes the later nonces of the sender",
+			[]testTransaction{{"a", 0, 100}, {"a", 1, 100}, {"b", 0, 100}},
+			[]time.Duration{2 * time.Hour, 0, 0},
+			[]string{"b/0"},
+		},
+		{
+			"expiry keeps the earlier nonces of the sender",
+			[]testTransaction{{"a", 0, 100}, {"a", 1, 100}, {"b", 0, 100}},
+			[]time.Duration{0, 2 * time.Hour, 0},
+			[]string{"a/0", "b/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(10, time.Hour)
+			for i, pooled := range tt.pooled {
+				tx := pooled.transaction()
+				if err := p.Add(tx); err != nil {
+					t.Fatalf("Add(%s): %v", pooled.name(), err)
+				}
+				p.entries[tx.Hash()].added = now.Add(-tt.ages[i])
+			}
+
+			p.Expire(now)
+
+			if got := names(p.Transactions()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pool = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetain(t *testing.T) {
+	pooled := []testTransaction{{"a", 0, 100}, {"b", 0, 300}, {"a", 1, 200}, {"c", 0, 100}}
+
+	tests := []struct {
+		name string
+		drop []string
+		want []string
+	}{
+		{"keep all", nil, []string{"a/0", "b/0", "a/1", "c/0"}},
+		{"drop one", []string{"b/0"}, []string{"a/0", "a/1", "c/0"}},
+		{"drop the last nonce", []string{"a/1"}, []string{"a/0", "b/0", "c/0"}},
+		{"drop takes the later nonces", []string{"a/0"}, []string{"b/0", "c/0"}},
+		{"drop all", []string{"a/0", "b/0", "c/0"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(10, time.Hour)
+			for _, pooled := range pooled {
+				if err := p.Add(pooled.transaction()); err != nil {
+					t.Fatalf("Add(%s): %v", pooled.name(), err)
+				}
+			}
+
+			drop := make(map[string]bool)
+			for _, name := range tt.drop {
+				drop[name] = true
+			}
+
+			visited := make([]string, 0)
+			p.Retain(func(tx *transaction.Transaction) bool {
+				name := names([]*transaction.Transaction{tx})[0]
+				visited = append(visited, name)
+				return !drop[name]
+			})
+
+			if want := []string{"a/0", "b/0", "a/1", "c/0"}; !reflect.DeepEqual(visited, want) {
+				t.Errorf("visited %v, want the arrival order %v", visited, want)
+			}
+
+			if got := names(p.Transactions()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pool = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
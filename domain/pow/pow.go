@@ -0,0 +1,117 @@
+package pow
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// POW_LIMIT_BITS is the easiest target any block may be mined at.
+const POW_LIMIT_BITS uint32 = 0x2000ffff
+
+var PowLimit = CompactToBig(POW_LIMIT_BITS)
+
+// CompactToBig decodes the compact "bits" representation of a target: the
+// high byte is the length of the number in bytes, the low 23 bits are its
+// most significant bytes and bit 23 is the sign.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+
+	if isNegative {
+		n.Neg(n)
+	}
+
+	return n
+}
+
+// BigToCompact is the inverse of CompactToBig. Precision below the three
+// most significant bytes is lost.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	abs := new(big.Int).Abs(n)
+	exponent := uint(len(abs.Bytes()))
+
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(abs.Uint64())
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		mantissa = uint32(abs.Rsh(abs, 8*(exponent-3)).Uint64())
+	}
+
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+func HashToBig(hash [32]byte) *big.Int {
+	return new(big.Int).SetBytes(hash[:])
+}
+
+// Target returns the target of the bits as a big-endian 32 byte array, so it
+// can be compared against a hash without any allocation.
+func Target(bits uint32) [32]byte {
+	var target [32]byte
+
+	t := CompactToBig(bits)
+	if t.Sign() <= 0 || t.Cmp(PowLimit) > 0 {
+		return target
+	}
+
+	t.FillBytes(target[:])
+
+	return target
+}
+
+// CheckHash reports whether the hash, read as a big-endian number, does not
+// exceed the target. The zero target, which Target returns for invalid bits,
+// never passes.
+func CheckHash(hash [32]byte, target [32]byte) bool {
+	return target != [32]byte{} && bytes.Compare(hash[:], target[:]) <= 0
+}
+
+// CheckProofOfWork reports whether the hash satisfies the target encoded in
+// bits. Targets that are not positive or above the limit never pass.
+func CheckProofOfWork(hash [32]byte, bits uint32) bool {
+	t := CompactToBig(bits)
+	if t.Sign() <= 0 || t.Cmp(PowLimit) > 0 {
+		return false
+	}
+
+	return HashToBig(hash).Cmp(t) <= 0
+}
+
+// CalcWork returns the expected number of hashes needed to find a block at
+// the target encoded in bits, 2^256 / (target + 1).
+func CalcWork(bits uint32) *big.Int {
+	t := CompactToBig(bits)
+	if t.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(t, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return numerator.Div(numerator, denominator)
+}
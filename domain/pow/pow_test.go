@@ -0,0 +1,148 @@
+package pow
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		compact uint32
+		n       string
+	}{
+		{"exponent 1", 0x01120000, "12"},
+		{"exponent 2", 0x02123400, "1234"},
+		{"exponent 3", 0x03123456, "123456"},
+		{"mantissa high bit", 0x02008000, "80"},
+		{"mantissa high bit, large", 0x05009234, "92340000"},
+		{"negative", 0x04923456, "-12345600"},
+		{"pow limit", POW_LIMIT_BITS, "ffff" + strings.Repeat("0", 58)},
+		{"bitcoin genesis", 0x1d00ffff, "ffff" + strings.Repeat("0", 52)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, _ := new(big.Int).SetString(tt.n, 16)
+
+			if got := CompactToBig(tt.compact); got.Cmp(n) != 0 {
+				t.Errorf("CompactToBig(%08x) = %x, want %x", tt.compact, got, n)
+			}
+
+			if got := BigToCompact(n); got != tt.compact {
+				t.Errorf("BigToCompact(%x) = %08x, want %08x", n, got, tt.compact)
+			}
+		})
+	}
+}
+
+func TestCompactToBigSmallExponent(t *testing.T) {
+	tests := []struct {
+		compact uint32
+		want    int64
+	}{
+		{0x00123456, 0},
+		{0x01003456, 0},
+		{0x02000056, 0},
+		{0x03000000, 0},
+		{0x01123456, 0x12},
+		{0x02123456, 0x1234},
+	}
+
+	for _, tt := range tests {
+		if got := CompactToBig(tt.compact); got.Int64() != tt.want {
+			t.Errorf("CompactToBig(%08x) = %x, want %x", tt.compact, got, tt.want)
+		}
+	}
+
+	if got := BigToCompact(big.NewInt(0)); got != 0 {
+		t.Errorf("BigToCompact(0) = %08x, want 0", got)
+	}
+}
+
+func TestPowLimit(t *testing.T) {
+	want := new(big.Int).Lsh(big.NewInt(0xffff), 8*(0x20-3))
+	if PowLimit.Cmp(want) != 0 {
+		t.Errorf("PowLimit = %x, want %x", PowLimit, want)
+	}
+
+	if got := BigToCompact(PowLimit); got != POW_LIMIT_BITS {
+		t.Errorf("BigToCompact(PowLimit) = %08x, want %08x", got, POW_LIMIT_BITS)
+	}
+}
+
+func TestCheckHashAgreesWithCheckProofOfWork(t *testing.T) {
+	bits := []uint32{
+		0x1f0fffff,
+		0x1d00ffff,
+		0x2000ffff,
+		0x03123456,
+		0,
+		0x04923456,
+		0x2100ffff,
+	}
+
+	for _, b := range bits {
+		target := CompactToBig(b)
+
+		hashes := []*big.Int{
+			big.NewInt(0),
+			big.NewInt(1),
+			new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)),
+		}
+		if target.Sign() > 0 && target.BitLen() <= 256 {
+			hashes = append(hashes,
+				new(big.Int).Sub(target, big.NewInt(1)),
+				new(big.Int).Set(target),
+				new(big.Int).Add(target, big.NewInt(1)),
+			)
+		}
+
+		for _, h := range hashes {
+			var hash [32]byte
+			h.FillBytes(hash[:])
+
+			want := CheckProofOfWork(hash, b)
+			if got := CheckHash(hash, Target(b)); got != want {
+				t.Errorf("bits %08x, hash %x: CheckHash = %v, CheckProofOfWork = %v", b, h, got, want)
+			}
+		}
+	}
+}
+
+func TestCheckProofOfWorkAtTarget(t *testing.T) {
+	target := CompactToBig(0x1f0fffff)
+
+	var at, above [32]byte
+	target.FillBytes(at[:])
+	new(big.Int).Add(target, big.NewInt(1)).FillBytes(above[:])
+
+	if !CheckProofOfWork(at, 0x1f0fffff) {
+		t.Error("hash equal to the target does not pass")
+	}
+
+	if CheckProofOfWork(above, 0x1f0fffff) {
+		t.Error("hash above the target passes")
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0x1d00ffff, "100010001"},
+		{0x2000ffff, "100"},
+		{0x207fffff, "2"},
+		{0, "0"},
+		{0x04923456, "0"},
+	}
+
+	for _, tt := range tests {
+		want, _ := new(big.Int).SetString(tt.want, 16)
+		if got := CalcWork(tt.bits); got.Cmp(want) != 0 {
+			t.Errorf("CalcWork(%08x) = %x, want %x", tt.bits, got, want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	BLOCKS_FILE = "blocks.jsonl"
+	POOL_FILE   = "pool.json"
+	TMP_SUFFIX  = ".tmp"
+)
+
+// FileStore keeps the chain in an append-only file with one JSON encoded
+// block per line. A block only counts as stored once its terminating newline
+// has been synced to disk, so a torn write is dropped on the next load.
+type FileStore struct {
+	sync.Mutex
+	dir    string
+	blocks *os.File
+	size   int64
+
+	// offsets[h] is where the block at height h starts in the blocks file.
+	offsets []int64
+	hashes  map[[32]byte]int
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := openBlocksFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:    dir,
+		blocks: f,
+	}
+
+	if _, err := s.readChain(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func openBlocksFile(dir string) (*os.File, error) {
+	return os.OpenFile(
+		filepath.Join(dir, BLOCKS_FILE),
+		os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		0o644,
+	)
+}
+
+func (s *FileStore) Dir() string {
+	return s.dir
+}
+
+// LoadChain reads every complete block from disk. An unterminated trailing
+// line left behind by a crash is truncated away.
+func (s *FileStore) LoadChain() ([]*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.readChain()
+}
+
+func (s *FileStore) readChain() ([]*block.Block, error) {
+	if _, err := s.blocks.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	chain := make([]*block.Block, 0)
+	s.offsets = make([]int64, 0)
+	s.hashes = make(map[[32]byte]int)
+	s.size = 0
+
+	reader := bufio.NewReader(s.blocks)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := s.blocks.Truncate(s.size); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		b := new(block.Block)
+		if err := json.Unmarshal(bytes.TrimSpace(line), b); err != nil {
+			return nil, fmt.Errorf("store: corrupt block %d: %w", len(chain), err)
+		}
+
+		s.index(b)
+		s.size += int64(len(line))
+		chain = append(chain, b)
+	}
+
+	return chain, nil
+}
+
+func (s *FileStore) index(b *block.Block) {
+	s.hashes[b.Hash()] = len(s.offsets)
+	s.offsets = append(s.offsets, s.size)
+}
+
+func (s *FileStore) AppendBlock(b *block.Block) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	line := append(m, '\n')
+	if _, err := s.blocks.Write(line); err != nil {
+		return s.discardPartialWrite(err)
+	}
+
+	if err := s.blocks.Sync(); err != nil {
+		return s.discardPartialWrite(err)
+	}
+
+	s.index(b)
+	s.size += int64(len(line))
+
+	return nil
+}
+
+// discardPartialWrite truncates whatever the append that failed with err left
+// after the last complete block, so that the next append does not land after
+// an unterminated fragment.
+func (s *FileStore) discardPartialWrite(err error) error {
+	if terr := s.blocks.Truncate(s.size); terr != nil {
+		return fmt.Errorf("store: %v, then truncating the partial block: %w", err, terr)
+	}
+
+	return err
+}
+
+func (s *FileStore) BlockByHeight(height int) (*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.readBlock(height)
+}
+
+func (s *FileStore) BlockByHash(hash [32]byte) (*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	height, ok := s.hashes[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return s.readBlock(height)
+}
+
+func (s *FileStore) readBlock(height int) (*block.Block, error) {
+	if height < 0 || height >= len(s.offsets) {
+		return nil, ErrNotFound
+	}
+
+	end := s.size
+	if height+1 < len(s.offsets) {
+		end = s.offsets[height+1]
+	}
+
+	line := make([]byte, end-s.offsets[height])
+	if _, err := s.blocks.ReadAt(line, s.offsets[height]); err != nil {
+		return nil, err
+	}
+
+	b := new(block.Block)
+	if err := json.Unmarshal(bytes.TrimSpace(line), b); err != nil {
+		return nil, fmt.Errorf("store: corrupt block %d: %w", height, err)
+	}
+
+	return b, nil
+}
+
+// ReplaceChain writes the new chain to a temporary file and renames it over
+// the current one, so a crash leaves either the old or the new chain intact.
+func (s *FileStore) ReplaceChain(chain []*block.Block) error {
+	s.Lock()
+	defer s.Unlock()
+
+	var buf bytes.Buffer
+	for _, b := range chain {
+		m, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(m)
+		buf.WriteByte('\n')
+	}
+
+	if err := s.writeFileAtomic(BLOCKS_FILE, buf.Bytes()); err != nil {
+		return err
+	}
+
+	s.blocks.Close()
+
+	f, err := openBlocksFile(s.dir)
+	if err != nil {
+		return err
+	}
+	s.blocks = f
+
+	_, err = s.readChain()
+
+	return err
+}
+
+func (s *FileStore) LoadTransactionPool() ([]*transaction.Transaction, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	transactions := make([]*transaction.Transaction, 0)
+
+	m, err := os.ReadFile(filepath.Join(s.dir, POOL_FILE))
+	if os.IsNotExist(err) {
+		return transactions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(m, &transactions); err != nil {
+		return nil, fmt.Errorf("store: corrupt transaction pool: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (s *FileStore) SaveTransactionPool(transactions []*transaction.Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m, err := json.Marshal(transactions)
+	if err != nil {
+		return err
+	}
+
+	return s.writeFileAtomic(POOL_FILE, m)
+}
+
+func (s *FileStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.blocks.Close()
+}
+
+func (s *FileStore) writeFileAtomic(name string, data []byte) error {
+	path := filepath.Join(s.dir, name)
+	tmpPath := path + TMP_SUFFIX
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(s.dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+	"sync"
+)
+
+// MemoryStore keeps everything in process memory and loses it on exit.
+type MemoryStore struct {
+	sync.Mutex
+	chain           []*block.Block
+	hashes          map[[32]byte]int
+	transactionPool []*transaction.Transaction
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		chain:  make([]*block.Block, 0),
+		hashes: make(map[[32]byte]int),
+	}
+}
+
+func (s *MemoryStore) LoadChain() ([]*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	chain := make([]*block.Block, len(s.chain))
+	copy(chain, s.chain)
+
+	return chain, nil
+}
+
+func (s *MemoryStore) AppendBlock(b *block.Block) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.hashes[b.Hash()] = len(s.chain)
+	s.chain = append(s.chain, b)
+
+	return nil
+}
+
+func (s *MemoryStore) BlockByHeight(height int) (*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if height < 0 || height >= len(s.chain) {
+		return nil, ErrNotFound
+	}
+
+	return s.chain[height], nil
+}
+
+func (s *MemoryStore) BlockByHash(hash [32]byte) (*block.Block, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	height, ok := s.hashes[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return s.chain[height], nil
+}
+
+func (s *MemoryStore) ReplaceChain(chain []*block.Block) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.chain = make([]*block.Block, len(chain))
+	s.hashes = make(map[[32]byte]int, len(chain))
+
+	for i, b := range chain {
+		s.chain[i] = b
+		s.hashes[b.Hash()] = i
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) LoadTransactionPool() ([]*transaction.Transaction, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	transactions := make([]*transaction.Transaction, len(s.transactionPool))
+	copy(transactions, s.transactionPool)
+
+	return transactions, nil
+}
+
+func (s *MemoryStore) SaveTransactionPool(transactions []*transaction.Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.transactionPool = make([]*transaction.Transaction, len(transactions))
+	copy(s.transactionPool, transactions)
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
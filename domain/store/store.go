@@ -0,0 +1,22 @@
+package store
+
+import (
+	"errors"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+)
+
+var ErrNotFound = errors.New("store: block not found")
+
+// Store is the persistence backend of a Blockchain. Heights are zero based,
+// the genesis block is stored at height 0.
+type Store interface {
+	LoadChain() ([]*block.Block, error)
+	AppendBlock(b *block.Block) error
+	BlockByHeight(height int) (*block.Block, error)
+	BlockByHash(hash [32]byte) (*block.Block, error)
+	ReplaceChain(chain []*block.Block) error
+	LoadTransactionPool() ([]*transaction.Transaction, error)
+	SaveTransactionPool(transactions []*transaction.Transaction) error
+	Close() error
+}
@@ -0,0 +1,53 @@
+package transaction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Input spends the output at Index of the transaction hashed to PreviousHash.
+type Input struct {
+	PreviousHash [32]byte
+	Index        int
+}
+
+func NewInput(previousHash [32]byte, index int) *Input {
+	return &Input{
+		PreviousHash: previousHash,
+		Index:        index,
+	}
+}
+
+func (i *Input) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		PreviousHash string `json:"previous_hash"`
+		Index        int    `json:"index"`
+	}{
+		PreviousHash: fmt.Sprintf("%x", i.PreviousHash),
+		Index:        i.Index,
+	})
+}
+
+func (i *Input) UnmarshalJSON(data []byte) error {
+	var previousHash string
+	v := &struct {
+		PreviousHash *string `json:"previous_hash"`
+		Index        *int    `json:"index"`
+	}{
+		PreviousHash: &previousHash,
+		Index:        &i.Index,
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	ph, err := hex.DecodeString(previousHash)
+	if err != nil || len(ph) != 32 {
+		return fmt.Errorf("invalid previous_hash %q", previousHash)
+	}
+	copy(i.PreviousHash[:], ph)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package transaction
+
+import (
+	"encoding/json"
+	"goblockchain/domain/amount"
+)
+
+// Output locks Value to BlockchainAddress until an Input spends it.
+type Output struct {
+	BlockchainAddress string
+	Value             amount.Amount
+}
+
+func NewOutput(blockchainAddress string, value amount.Amount) *Output {
+	return &Output{
+		BlockchainAddress: blockchainAddress,
+		Value:             value,
+	}
+}
+
+func (o *Output) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlockchainAddress string        `json:"blockchain_address"`
+		Value             amount.Amount `json:"value"`
+	}{
+		BlockchainAddress: o.BlockchainAddress,
+		Value:             o.Value,
+	})
+}
+
+func (o *Output) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		BlockchainAddress *string        `json:"blockchain_address"`
+		Value             *amount.Amount `json:"value"`
+	}{
+		BlockchainAddress: &o.BlockchainAddress,
+		Value:             &o.Value,
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	return nil
+}
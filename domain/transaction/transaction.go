@@ -1,53 +1,174 @@
 package transaction
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"goblockchain/domain/amount"
 	"strings"
 )
 
+// Transaction moves value from outputs owned by the sender to new outputs.
+// Nonce is the sequence number of the transaction among all transactions of
+// the sender, starting at 0; it is part of the signed bytes so that a signed
+// transaction cannot be replayed. Fee is paid to the miner of the block that
+// includes the transaction, on top of the outputs.
+//
+// SenderPublicKey and Signature are hex encoded and kept with the transaction
+// so that every node can verify it again when it syncs the chain. They are
+// not part of the signed bytes, see SigningBytes, but are part of the hash.
 type Transaction struct {
-	SenderBlockchainAddress    string
-	RecipientBlockchainAddress string
-	Value                      float32
+	SenderBlockchainAddress string
+	SenderPublicKey         string
+	Nonce                   uint64
+	Fee                     amount.Amount
+	Inputs                  []*Input
+	Outputs                 []*Output
+	Signature               string
 }
 
-func NewTransaction(sender, recipient string, value float32) *Transaction {
+func NewTransaction(
+	sender string,
+	publicKey string,
+	nonce uint64,
+	fee amount.Amount,
+	inputs []*Input,
+	outputs []*Output,
+	signature string,
+) *Transaction {
 	return &Transaction{
-		SenderBlockchainAddress:    sender,
-		RecipientBlockchainAddress: recipient,
-		Value:                      value,
+		SenderBlockchainAddress: sender,
+		SenderPublicKey:         publicKey,
+		Nonce:                   nonce,
+		Fee:                     fee,
+		Inputs:                  inputs,
+		Outputs:                 outputs,
+		Signature:               signature,
 	}
 }
 
+// NewCoinbaseTransaction creates the transaction that mints the block reward.
+// Its single input spends nothing and carries the block height, so that
+// coinbases of different blocks never hash to the same value.
+func NewCoinbaseTransaction(sender, recipient string, value amount.Amount, height int) *Transaction {
+	return &Transaction{
+		SenderBlockchainAddress: sender,
+		Inputs: []*Input{
+			NewInput([32]byte{}, height),
+		},
+		Outputs: []*Output{
+			NewOutput(recipient, value),
+		},
+	}
+}
+
+func (t *Transaction) IsCoinbase() bool {
+	return len(t.Inputs) == 1 && t.Inputs[0].PreviousHash == [32]byte{}
+}
+
+func (t *Transaction) Hash() [32]byte {
+	m, _ := json.Marshal(t)
+	return sha256.Sum256(m)
+}
+
+// SigningBytes is the serialization the sender signs. It leaves out the
+// public key and the signature, and must match wallet.Transaction.MarshalJSON.
+func (t *Transaction) SigningBytes() []byte {
+	m, _ := json.Marshal(struct {
+		Sender  string        `json:"sender_blockchain_address"`
+		Nonce   uint64        `json:"nonce"`
+		Fee     amount.Amount `json:"fee"`
+		Inputs  []*Input      `json:"inputs"`
+		Outputs []*Output     `json:"outputs"`
+	}{
+		Sender:  t.SenderBlockchainAddress,
+		Nonce:   t.Nonce,
+		Fee:     t.Fee,
+		Inputs:  t.Inputs,
+		Outputs: t.Outputs,
+	})
+
+	return m
+}
+
+// ID is the hex encoded hash, the canonical identifier of the transaction.
+func (t *Transaction) ID() string {
+	return fmt.Sprintf("%x", t.Hash())
+}
+
+func (t *Transaction) OutputValue() amount.Amount {
+	var total amount.Amount = 0
+
+	for _, o := range t.Outputs {
+		total += o.Value
+	}
+
+	return total
+}
+
+// Size is the length of the serialized transaction in bytes.
+func (t *Transaction) Size() int {
+	m, _ := json.Marshal(t)
+	return len(m)
+}
+
+// FeeRate is the fee paid per serialized byte.
+func (t *Transaction) FeeRate() float64 {
+	return float64(t.Fee) / float64(t.Size())
+}
+
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf(" sender_blockchain_address %s\n", t.SenderBlockchainAddress)
-	fmt.Printf(" recipient_blockchain_address %s\n", t.RecipientBlockchainAddress)
-	fmt.Printf(" value %.1f\n", t.Value)
+	fmt.Printf(" sender_public_key %s\n", t.SenderPublicKey)
+	fmt.Printf(" nonce %d\n", t.Nonce)
+	fmt.Printf(" fee %s\n", t.Fee)
+	for _, i := range t.Inputs {
+		fmt.Printf(" input %x:%d\n", i.PreviousHash, i.Index)
+	}
+	for _, o := range t.Outputs {
+		fmt.Printf(" output %s %s\n", o.BlockchainAddress, o.Value)
+	}
+	fmt.Printf(" signature %s\n", t.Signature)
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender    string        `json:"sender_blockchain_address"`
+		PublicKey string        `json:"sender_public_key"`
+		Nonce     uint64        `json:"nonce"`
+		Fee       amount.Amount `json:"fee"`
+		Inputs    []*Input      `json:"inputs"`
+		Outputs   []*Output     `json:"outputs"`
+		Signature string        `json:"signature"`
 	}{
 		Sender:    t.SenderBlockchainAddress,
-		Recipient: t.RecipientBlockchainAddress,
-		Value:     t.Value,
+		PublicKey: t.SenderPublicKey,
+		Nonce:     t.Nonce,
+		Fee:       t.Fee,
+		Inputs:    t.Inputs,
+		Outputs:   t.Outputs,
+		Signature: t.Signature,
 	})
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
 	v := struct {
-		Sender    *string  `json:"sender_blockchain_address"`
-		Recipient *string  `json:"recipient_blockchain_address"`
-		Value     *float32 `json:"value"`
+		Sender    *string        `json:"sender_blockchain_address"`
+		PublicKey *string        `json:"sender_public_key"`
+		Nonce     *uint64        `json:"nonce"`
+		Fee       *amount.Amount `json:"fee"`
+		Inputs    *[]*Input      `json:"inputs"`
+		Outputs   *[]*Output     `json:"outputs"`
+		Signature *string        `json:"signature"`
 	}{
 		Sender:    &t.SenderBlockchainAddress,
-		Recipient: &t.RecipientBlockchainAddress,
-		Value:     &t.Value,
+		PublicKey: &t.SenderPublicKey,
+		Nonce:     &t.Nonce,
+		Fee:       &t.Fee,
+		Inputs:    &t.Inputs,
+		Outputs:   &t.Outputs,
+		Signature: &t.Signature,
 	}
 
 	if err := json.Unmarshal(data, &v); err != nil {
@@ -0,0 +1,217 @@
+package utxo
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/block"
+	"goblockchain/domain/transaction"
+	"sort"
+)
+
+// Outpoint identifies a single output of a transaction.
+type Outpoint struct {
+	Hash  [32]byte
+	Index int
+}
+
+// Entry is an unspent output together with the height of the block that
+// created it and whether a coinbase created it.
+type Entry struct {
+	Outpoint
+	Output   *transaction.Output
+	Height   int
+	Coinbase bool
+}
+
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransactionHash   string        `json:"transaction_hash"`
+		Index             int           `json:"index"`
+		BlockchainAddress string        `json:"blockchain_address"`
+		Value             amount.Amount `json:"value"`
+		Height            int           `json:"height"`
+		Coinbase          bool          `json:"coinbase"`
+	}{
+		TransactionHash:   fmt.Sprintf("%x", e.Hash),
+		Index:             e.Index,
+		BlockchainAddress: e.Output.BlockchainAddress,
+		Value:             e.Output.Value,
+		Height:            e.Height,
+		Coinbase:          e.Coinbase,
+	})
+}
+
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var transactionHash string
+	e.Output = new(transaction.Output)
+	v := &struct {
+		TransactionHash   *string        `json:"transaction_hash"`
+		Index             *int           `json:"index"`
+		BlockchainAddress *string        `json:"blockchain_address"`
+		Value             *amount.Amount `json:"value"`
+		Height            *int           `json:"height"`
+		Coinbase          *bool          `json:"coinbase"`
+	}{
+		TransactionHash:   &transactionHash,
+		Index:             &e.Index,
+		BlockchainAddress: &e.Output.BlockchainAddress,
+		Value:             &e.Output.Value,
+		Height:            &e.Height,
+		Coinbase:          &e.Coinbase,
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	h, err := hex.DecodeString(transactionHash)
+	if err != nil || len(h) != 32 {
+		return fmt.Errorf("invalid transaction_hash %q", transactionHash)
+	}
+	copy(e.Hash[:], h)
+
+	return nil
+}
+
+// Set is the collection of all unspent transaction outputs, indexed by
+// outpoint and by owning address.
+type Set struct {
+	entries   map[Outpoint]*Entry
+	byAddress map[string]map[Outpoint]*Entry
+}
+
+func NewSet() *Set {
+	return &Set{
+		entries:   make(map[Outpoint]*Entry),
+		byAddress: make(map[string]map[Outpoint]*Entry),
+	}
+}
+
+func (s *Set) Get(op Outpoint) (*Entry, bool) {
+	e, ok := s.entries[op]
+	return e, ok
+}
+
+// CheckBlock reports whether every non-coinbase input of the block spends an
+// existing output exactly once.
+func (s *Set) CheckBlock(b *block.Block) error {
+	spent := make(map[Outpoint]bool)
+
+	for _, t := range b.Transactions {
+		if t.IsCoinbase() {
+			continue
+		}
+
+		for _, i := range t.Inputs {
+			op := Outpoint{Hash: i.PreviousHash, Index: i.Index}
+
+			if _, ok := s.entries[op]; !ok {
+				return fmt.Errorf("utxo: input %x:%d is not unspent", op.Hash, op.Index)
+			}
+
+			if spent[op] {
+				return fmt.Errorf("utxo: input %x:%d is spent twice", op.Hash, op.Index)
+			}
+			spent[op] = true
+		}
+	}
+
+	return nil
+}
+
+// ApplyBlock spends the inputs and adds the outputs of every transaction in
+// the block. It returns the spent entries, or leaves the set untouched and
+// returns an error if the block spends anything that is not unspent.
+func (s *Set) ApplyBlock(b *block.Block, height int) ([]*Entry, error) {
+	if err := s.CheckBlock(b); err != nil {
+		return nil, err
+	}
+
+	spent := make([]*Entry, 0)
+
+	for _, t := range b.Transactions {
+		if !t.IsCoinbase() {
+			for _, i := range t.Inputs {
+				op := Outpoint{Hash: i.PreviousHash, Index: i.Index}
+				spent = append(spent, s.entries[op])
+				s.remove(op)
+			}
+		}
+
+		hash := t.Hash()
+		for index, o := range t.Outputs {
+			s.add(&Entry{
+				Outpoint: Outpoint{Hash: hash, Index: index},
+				Output:   o,
+				Height:   height,
+				Coinbase: t.IsCoinbase(),
+			})
+		}
+	}
+
+	return spent, nil
+}
+
+// UndoBlock reverts ApplyBlock: it removes the outputs of the block and
+// restores the entries it spent.
+func (s *Set) UndoBlock(b *block.Block, spent []*Entry) {
+	for _, t := range b.Transactions {
+		hash := t.Hash()
+		for index := range t.Outputs {
+			s.remove(Outpoint{Hash: hash, Index: index})
+		}
+	}
+
+	for _, e := range spent {
+		s.add(e)
+	}
+}
+
+func (s *Set) add(e *Entry) {
+	s.entries[e.Outpoint] = e
+
+	address := e.Output.BlockchainAddress
+	if s.byAddress[address] == nil {
+		s.byAddress[address] = make(map[Outpoint]*Entry)
+	}
+	s.byAddress[address][e.Outpoint] = e
+}
+
+func (s *Set) remove(op Outpoint) {
+	e, ok := s.entries[op]
+	if !ok {
+		return
+	}
+
+	delete(s.entries, op)
+
+	address := e.Output.BlockchainAddress
+	delete(s.byAddress[address], op)
+	if len(s.byAddress[address]) == 0 {
+		delete(s.byAddress, address)
+	}
+}
+
+// FindByAddress returns the unspent outputs owned by the address, oldest
+// first.
+func (s *Set) FindByAddress(blockchainAddress string) []*Entry {
+	entries := make([]*Entry, 0, len(s.byAddress[blockchainAddress]))
+
+	for _, e := range s.byAddress[blockchainAddress] {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Height != entries[j].Height {
+			return entries[i].Height < entries[j].Height
+		}
+		if entries[i].Hash != entries[j].Hash {
+			return string(entries[i].Hash[:]) < string(entries[j].Hash[:])
+		}
+		return entries[i].Index < entries[j].Index
+	})
+
+	return entries
+}
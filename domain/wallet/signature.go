@@ -17,6 +17,14 @@ func (s *Signature) String() string {
 	return fmt.Sprintf("%064x%064x", s.R, s.S)
 }
 
+// IsLowS reports whether S is in the lower half of the curve order. Both S
+// and N - S verify, so only the low one is accepted; otherwise anyone could
+// change the signature, and with it the transaction ID, without the key.
+func (s *Signature) IsLowS() bool {
+	halfOrder := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+	return s.S.Cmp(halfOrder) <= 0
+}
+
 func SignatureFromString(s string) *Signature {
 	x, y := String2BigIntTuple(s)
 
@@ -5,30 +5,87 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/transaction"
+	"goblockchain/domain/utxo"
+	"math/big"
 )
 
+var ErrInsufficientFunds = errors.New("wallet: insufficient funds")
+
 type Transaction struct {
-	senderPrivateKey           *ecdsa.PrivateKey
-	senderPublicKey            *ecdsa.PublicKey
-	senderBlockchainAddress    string
-	recipientBlockchainAddress string
-	value                      float32
+	senderPrivateKey        *ecdsa.PrivateKey
+	senderPublicKey         *ecdsa.PublicKey
+	senderBlockchainAddress string
+	nonce                   uint64
+	fee                     amount.Amount
+	inputs                  []*transaction.Input
+	outputs                 []*transaction.Output
 }
 
+// NewTransaction spends the oldest of the sender's unspent outputs until they
+// cover value plus fee, and returns whatever is left over to the sender as
+// change.
 func NewTransaction(
 	privateKey *ecdsa.PrivateKey,
 	publicKey *ecdsa.PublicKey,
 	sender string,
 	recipient string,
-	value float32,
-) *Transaction {
-	return &Transaction{
-		senderPrivateKey:           privateKey,
-		senderPublicKey:            publicKey,
-		senderBlockchainAddress:    sender,
-		recipientBlockchainAddress: recipient,
-		value:                      value,
+	value amount.Amount,
+	fee amount.Amount,
+	nonce uint64,
+	unspent []*utxo.Entry,
+) (*Transaction, error) {
+	inputs := make([]*transaction.Input, 0)
+	var total amount.Amount = 0
+
+	for _, e := range unspent {
+		if total >= value+fee {
+			break
+		}
+
+		inputs = append(inputs, transaction.NewInput(e.Hash, e.Index))
+		total += e.Output.Value
+	}
+
+	if total < value+fee {
+		return nil, ErrInsufficientFunds
 	}
+
+	outputs := []*transaction.Output{
+		transaction.NewOutput(recipient, value),
+	}
+
+	if change := total - value - fee; change > 0 {
+		outputs = append(outputs, transaction.NewOutput(sender, change))
+	}
+
+	return &Transaction{
+		senderPrivateKey:        privateKey,
+		senderPublicKey:         publicKey,
+		senderBlockchainAddress: sender,
+		nonce:                   nonce,
+		fee:                     fee,
+		inputs:                  inputs,
+		outputs:                 outputs,
+	}, nil
+}
+
+func (t *Transaction) Nonce() uint64 {
+	return t.nonce
+}
+
+func (t *Transaction) Fee() amount.Amount {
+	return t.fee
+}
+
+func (t *Transaction) Inputs() []*transaction.Input {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*transaction.Output {
+	return t.outputs
 }
 
 func (t *Transaction) GenerateSignature() *Signature {
@@ -37,20 +94,32 @@ func (t *Transaction) GenerateSignature() *Signature {
 	h := sha256.Sum256(m)
 	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
 
+	// Nodes only accept the low S form, see Signature.IsLowS.
+	n := t.senderPrivateKey.Curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+
 	return &Signature{
 		R: r,
 		S: s,
 	}
 }
 
+// MarshalJSON produces the bytes that are signed, the same as
+// transaction.Transaction.SigningBytes.
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender  string                `json:"sender_blockchain_address"`
+		Nonce   uint64                `json:"nonce"`
+		Fee     amount.Amount         `json:"fee"`
+		Inputs  []*transaction.Input  `json:"inputs"`
+		Outputs []*transaction.Output `json:"outputs"`
 	}{
-		Sender:    t.senderBlockchainAddress,
-		Recipient: t.recipientBlockchainAddress,
-		Value:     t.value,
+		Sender:  t.senderBlockchainAddress,
+		Nonce:   t.nonce,
+		Fee:     t.fee,
+		Inputs:  t.inputs,
+		Outputs: t.outputs,
 	})
 }
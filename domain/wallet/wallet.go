@@ -24,7 +24,7 @@ func NewWallet() *Wallet {
 	w := new(Wallet)
 	w.privateKey = privateKey
 	w.publicKey = &privateKey.PublicKey
-	w.blockchainAddress = w.generateBlockchainAddress()
+	w.blockchainAddress = BlockchainAddressFromPublicKey(w.publicKey)
 
 	return w
 }
@@ -61,11 +61,13 @@ func (w *Wallet) MarshalJSON() ([]byte, error) {
 	})
 }
 
-func (w *Wallet) generateBlockchainAddress() string {
+// BlockchainAddressFromPublicKey derives the address that the owner of the
+// public key can spend from.
+func BlockchainAddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
 	// Perform SHA-256 hashing on the public key (32 bytes)
 	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
 	digest2 := h2.Sum(nil)
 
 	// Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes)
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	breq "goblockchain/blockchain_server/pkg/dto/blockchain_requests"
 	bres "goblockchain/blockchain_server/pkg/dto/blockchain_responses"
+	"goblockchain/domain/amount"
+	"goblockchain/domain/utxo"
 	"goblockchain/domain/wallet"
 	wrs "goblockchain/wallet_server/pkg/dto/wallet_requests"
 	"goblockchain/wallet_server/utils"
@@ -90,59 +92,160 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 
 		publicKey := wallet.PublicKeyFromString(*t.SenderPublicKey)
 		privateKey := wallet.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		value, err := strconv.ParseFloat(*t.Value, 32)
+		value, err := amount.Parse(*t.Value)
 
-		if err != nil {
+		if err != nil || value == 0 {
 			log.Println("ERROR: parse error")
 			io.WriteString(w, string(failMessage))
 
 			return
 		}
 
-		value32 := float32(value)
+		var fee amount.Amount = 0
+		if t.Fee != nil && *t.Fee != "" {
+			fee, err = amount.Parse(*t.Fee)
+			if err != nil {
+				log.Println("ERROR: parse error")
+				io.WriteString(w, string(failMessage))
+
+				return
+			}
+		}
 
 		w.Header().Add("Content-Type", "application/json")
 
-		transaction := wallet.NewTransaction(
+		unspent, err := ws.unspentOutputs(*t.SenderBlockchainAddress)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(failMessage))
+
+			return
+		}
+
+		nonce, err := ws.nonce(*t.SenderBlockchainAddress)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(failMessage))
+
+			return
+		}
+
+		transaction, err := wallet.NewTransaction(
 			privateKey,
 			publicKey,
 			*t.SenderBlockchainAddress,
 			*t.RecipientBlockchainAddress,
-			value32,
+			value,
+			fee,
+			nonce,
+			unspent,
 		)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(failMessage))
+
+			return
+		}
+
 		signature := transaction.GenerateSignature()
 		signatureStr := signature.String()
+		transactionNonce := transaction.Nonce()
+		transactionFee := transaction.Fee()
+		inputs := transaction.Inputs()
+		outputs := transaction.Outputs()
 
 		bt := &breq.TransactionRequest{
-			SenderBlockchainAddress:    t.SenderBlockchainAddress,
-			RecipientBlockchainAddress: t.RecipientBlockchainAddress,
-			SenderPublicKey:            t.SenderPublicKey,
-			Value:                      &value32,
-			Signature:                  &signatureStr,
+			SenderBlockchainAddress: t.SenderBlockchainAddress,
+			SenderPublicKey:         t.SenderPublicKey,
+			Nonce:                   &transactionNonce,
+			Fee:                     &transactionFee,
+			Inputs:                  &inputs,
+			Outputs:                 &outputs,
+			Signature:               &signatureStr,
 		}
 
 		m, _ := json.Marshal(bt)
 		buf := bytes.NewBuffer(m)
 		url := fmt.Sprintf("%s/transactions", ws.Gateway())
 
-		res, _ := http.Post(
+		res, err := http.Post(
 			url,
 			"application/json",
 			buf,
 		)
-		if res.StatusCode == 201 {
-			m, _ := utils.JsonStatus("success")
-			io.WriteString(w, string(m))
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(failMessage))
+
 			return
 		}
+		defer res.Body.Close()
 
-		io.WriteString(w, string(failMessage))
+		// The node answers with the transaction ID, or with the reason it
+		// rejected the transaction; pass either on.
+		io.Copy(w, res.Body)
 	default:
 		log.Println("ERROR: Invalid HTTP Method")
 		w.WriteHeader(http.StatusBadRequest)
 	}
 }
 
+func (ws *WalletServer) unspentOutputs(blockchainAddress string) ([]*utxo.Entry, error) {
+	endpoint := fmt.Sprintf("%s/utxos", ws.Gateway())
+
+	client := &http.Client{}
+	bcsReq, _ := http.NewRequest("GET", endpoint, nil)
+
+	q := bcsReq.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	bcsReq.URL.RawQuery = q.Encode()
+
+	bcsResp, err := client.Do(bcsReq)
+	if err != nil {
+		return nil, err
+	}
+	defer bcsResp.Body.Close()
+
+	if bcsResp.StatusCode != 200 {
+		return nil, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+
+	var r bres.UnspentOutputsResponse
+	if err := json.NewDecoder(bcsResp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	return r.Outputs, nil
+}
+
+func (ws *WalletServer) nonce(blockchainAddress string) (uint64, error) {
+	endpoint := fmt.Sprintf("%s/nonce", ws.Gateway())
+
+	client := &http.Client{}
+	bcsReq, _ := http.NewRequest("GET", endpoint, nil)
+
+	q := bcsReq.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	bcsReq.URL.RawQuery = q.Encode()
+
+	bcsResp, err := client.Do(bcsReq)
+	if err != nil {
+		return 0, err
+	}
+	defer bcsResp.Body.Close()
+
+	if bcsResp.StatusCode != 200 {
+		return 0, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+
+	var r bres.NonceResponse
+	if err := json.NewDecoder(bcsResp.Body).Decode(&r); err != nil {
+		return 0, err
+	}
+
+	return r.Nonce, nil
+}
+
 func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 	failMessage, _ := utils.JsonStatus("fail")
 
@@ -178,11 +281,13 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 			}
 
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message       string `json:"message"`
+				Amount        string `json:"amount"`
+				PendingAmount string `json:"pending_amount"`
 			}{
-				Message: "success",
-				Amount:  r.Amount,
+				Message:       "success",
+				Amount:        r.Amount.String(),
+				PendingAmount: r.PendingAmount.String(),
 			})
 
 			io.WriteString(w, string(m[:]))
@@ -6,6 +6,7 @@ type TransactionRequest struct {
 	SenderPublicKey            *string `json:"sender_public_key"`
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee"`
 }
 
 func (tr *TransactionRequest) Validate() bool {